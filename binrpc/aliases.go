@@ -0,0 +1,66 @@
+package binrpc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Aliases maps the names of legacy MI commands, like "ps", to the RPC methods replacing them, like "core.ps".
+type Aliases map[string]string
+
+// DefaultAliases are the renames of the most common MI commands of Kamailio before 5.0. It can be extended in a copy:
+//
+//	aliases := maps.Clone(binrpc.DefaultAliases)
+//	aliases["my_command"] = "mymodule.command"
+var DefaultAliases = Aliases{
+	"arg":              "core.arg",
+	"kill":             "core.kill",
+	"ps":               "core.ps",
+	"pwd":              "core.pwd",
+	"uptime":           "core.uptime",
+	"version":          "core.version",
+	"which":            "system.listMethods",
+	"get_statistics":   "stats.get_statistics",
+	"reset_statistics": "stats.reset_statistics",
+	"address_reload":   "permissions.addressReload",
+	"trusted_reload":   "permissions.trustedReload",
+	"dlg_list":         "dlg.list",
+	"dlg_end_dlg":      "dlg.end_dlg",
+	"dp_reload":        "dialplan.reload",
+	"dp_translate":     "dialplan.translate",
+	"ds_list":          "dispatcher.list",
+	"ds_reload":        "dispatcher.reload",
+	"ds_set_state":     "dispatcher.set_state",
+	"lcr_reload":       "lcr.reload",
+	"sht_reload":       "htable.reload",
+	"t_uac_dlg":        "tm.t_uac_wait",
+	"ul_dump":          "ul.dump",
+	"ul_rm":            "ul.rm",
+	"ul_show_contact":  "ul.lookup",
+}
+
+// Resolve returns the RPC method for method. RPC methods, which always contain a dot like "core.uptime", are returned
+// unchanged, and an MI command without alias returns an error.
+func (aliases Aliases) Resolve(method string) (string, error) {
+	if strings.Contains(method, ".") {
+		return method, nil
+	}
+
+	if resolved, ok := aliases[method]; ok {
+		return resolved, nil
+	}
+
+	return "", fmt.Errorf("no alias for MI command %q", method)
+}
+
+// Call is like Call, after resolving method with the aliases.
+func (aliases Aliases) Call(rw io.ReadWriter, method string, args ...Record) ([]Record, error) {
+	resolved, err := aliases.Resolve(method)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Call(rw, resolved, args...)
+}
@@ -0,0 +1,67 @@
+package binrpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAliasesResolve(t *testing.T) {
+	aliases := Aliases{"my_command": "mymodule.command"}
+
+	for method, expected := range map[string]string{
+		"my_command":  "mymodule.command",
+		"core.uptime": "core.uptime",
+	} {
+		resolved, err := aliases.Resolve(method)
+
+		if err != nil {
+			t.Error(err)
+		} else if resolved != expected {
+			t.Errorf("%s: expected %s, got %s", method, expected, resolved)
+		}
+	}
+
+	if _, err := aliases.Resolve("ps"); err == nil {
+		t.Error("expected an error for an unknown MI command")
+	}
+	if resolved, _ := DefaultAliases.Resolve("ps"); resolved != "core.ps" {
+		t.Errorf("expected core.ps, got %s", resolved)
+	}
+}
+
+func TestAliasesCall(t *testing.T) {
+	handler := func(request []Record) (uint8, []Record) {
+		return PacketReply, request[:1]
+	}
+
+	records, err := DefaultAliases.Call(serve(t, handler), "uptime")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method, _ := records[0].String(); method != "core.uptime" {
+		t.Errorf("expected core.uptime, got %s", method)
+	}
+
+	addr, _ := listen(t, handler)
+	client, err := New(addr, WithAliases(DefaultAliases))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	records, err = client.Call(context.Background(), "ds_list")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method, _ := records[0].String(); method != "dispatcher.list" {
+		t.Errorf("expected dispatcher.list, got %s", method)
+	}
+
+	if _, err := client.Call(context.Background(), "bogus"); err == nil {
+		t.Error("expected an error for an unknown MI command")
+	}
+}
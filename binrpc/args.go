@@ -0,0 +1,206 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewInt returns an int Record. Ints are signed 32 bits on the wire, i must fit in 32 bits to be encoded.
+func NewInt(i int) Record {
+	return Record{Type: TypeInt, Value: i}
+}
+
+// NewString returns a string Record.
+func NewString(s string) Record {
+	return Record{Type: TypeString, Value: s}
+}
+
+// NewURI returns a string Record of uri, or an error if uri is not a SIP URI like "sip:alice@example.com".
+// The check is light: the scheme must be "sip", "sips" or "tel", followed by a value without spaces or null bytes.
+func NewURI(uri string) (Record, error) {
+	scheme, rest, ok := strings.Cut(uri, ":")
+
+	if !ok {
+		return Record{}, fmt.Errorf("invalid URI %q: missing scheme", uri)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "sip", "sips", "tel":
+	default:
+		return Record{}, fmt.Errorf("invalid URI %q: unsupported scheme %q", uri, scheme)
+	}
+
+	if rest == "" {
+		return Record{}, fmt.Errorf("invalid URI %q: empty", uri)
+	}
+	if strings.IndexByte(uri, 0x00) != -1 {
+		return Record{}, fmt.Errorf("invalid URI %q: contains a null byte", uri)
+	}
+	if strings.ContainsAny(uri, " \t\r\n") {
+		return Record{}, fmt.Errorf("invalid URI %q: contains a space", uri)
+	}
+
+	return NewString(uri), nil
+}
+
+// NewDouble returns a double Record. BINRPC encodes doubles as ints in thousandths, so f is truncated to 3 decimals
+// and must fit in 32 bits once multiplied by 1000. Use NewDoubleString when more precision is needed.
+func NewDouble(f float64) Record {
+	return Record{Type: TypeDouble, Value: f}
+}
+
+// NewDoubleString returns a string Record of f formatted with prec decimals, or with the fewest decimals representing
+// f exactly if prec is -1. It is meant for RPC parameters parsed from a string by Kamailio, avoiding the loss of
+// precision of NewDouble.
+func NewDoubleString(f float64, prec int) Record {
+	return NewString(strconv.FormatFloat(f, 'f', prec, 64))
+}
+
+// NewDuration returns an int Record of d in unit, like NewDuration(d, time.Millisecond) for a parameter in
+// milliseconds. The value is truncated to a whole number of units. It returns an error if unit is not positive, or if
+// the value does not fit in 32 bits.
+func NewDuration(d time.Duration, unit time.Duration) (Record, error) {
+	if unit <= 0 {
+		return Record{}, fmt.Errorf("invalid duration unit %v", unit)
+	}
+
+	n := d / unit
+
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return Record{}, fmt.Errorf("duration %v does not fit in 32 bits in units of %v", d, unit)
+	}
+
+	return NewInt(int(n)), nil
+}
+
+// NewBool returns an int Record: 1 for true and 0 for false. BINRPC has no boolean type, and flag-style parameters
+// of RPC methods expect these ints, like "1" and "0" typed in kamcmd.
+func NewBool(b bool) Record {
+	if b {
+		return NewInt(1)
+	}
+
+	return NewInt(0)
+}
+
+// NewStruct returns a struct Record of items, in order. A key may be repeated, like in the structs of Kamailio.
+func NewStruct(items ...StructItem) Record {
+	if items == nil {
+		items = []StructItem{}
+	}
+
+	return Record{Type: TypeStruct, Value: items}
+}
+
+// StructRecord returns a struct Record of items, the inverse of StructItems. It is the same as NewStruct, for items
+// built as a slice.
+func StructRecord(items []StructItem) Record {
+	return NewStruct(items...)
+}
+
+// Args converts Go values into records, to be used as arguments of Call:
+//
+//	args, err := binrpc.Args("table", "key", 42)
+//	records, err := binrpc.Call(conn, "htable.seti", args...)
+//
+// Valid types are int, string, float64, bool, Record and *Record, map[string]any for a struct, and []any or []Record
+// for an array. A bool is sent as the int 1 (true) or 0 (false), see NewBool. A time.Duration is sent as an int number
+// of seconds, the unit of most timeouts and expires of Kamailio: use NewDuration for another unit. The items of a
+// struct are sorted by key.
+//
+// A nil map or slice is sent as a struct or an array without items, like an empty one. Records are checked with
+// Validate, to fail before sending anything.
+func Args(values ...any) ([]Record, error) {
+	records := make([]Record, 0, len(values))
+
+	for i, v := range values {
+		record, err := newArg(v)
+
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// newArg converts v into a Record, see Args.
+func newArg(v any) (Record, error) {
+	switch v := v.(type) {
+	case int:
+		return NewInt(v), nil
+	case string:
+		return NewString(v), nil
+	case float64:
+		return NewDouble(v), nil
+	case bool:
+		return NewBool(v), nil
+	case time.Duration:
+		return NewDuration(v, time.Second)
+	case Record:
+		return v, v.Validate()
+	case *Record:
+		if v == nil {
+			return Record{}, errors.New("nil *Record")
+		}
+
+		return *v, v.Validate()
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		items := make([]StructItem, 0, len(v))
+
+		for _, key := range keys {
+			value, err := newArg(v[key])
+
+			if err != nil {
+				return Record{}, fmt.Errorf("%s: %w", key, err)
+			}
+
+			items = append(items, StructItem{Key: key, Value: value})
+		}
+
+		return Record{Type: TypeStruct, Value: items}, nil
+	case []Record:
+		if v == nil {
+			v = []Record{}
+		}
+
+		for i := range v {
+			if err := v[i].Validate(); err != nil {
+				return Record{}, fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+
+		return Record{Type: TypeArray, Value: v}, nil
+	case []any:
+		items := make([]Record, 0, len(v))
+
+		for i := range v {
+			item, err := newArg(v[i])
+
+			if err != nil {
+				return Record{}, fmt.Errorf("item %d: %w", i, err)
+			}
+
+			items = append(items, item)
+		}
+
+		return Record{Type: TypeArray, Value: items}, nil
+	}
+
+	return Record{}, fmt.Errorf("type %T not implemented", v)
+}
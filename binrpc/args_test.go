@@ -0,0 +1,224 @@
+package binrpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArgs(t *testing.T) {
+	record := NewString("raw")
+	records, err := Args("table", 42, 1.5, true, false, record, &record)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Record{
+		{Type: TypeString, Value: "table"},
+		{Type: TypeInt, Value: 42},
+		{Type: TypeDouble, Value: 1.5},
+		{Type: TypeInt, Value: 1},
+		{Type: TypeInt, Value: 0},
+		{Type: TypeString, Value: "raw"},
+		{Type: TypeString, Value: "raw"},
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d", len(expected), len(records))
+	}
+
+	for i := range expected {
+		if records[i].Type != expected[i].Type || records[i].Value != expected[i].Value {
+			t.Errorf("argument %d: expected %v, got %v", i, expected[i], records[i])
+		}
+	}
+
+	if _, err := Args(struct{}{}); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+
+	invalid := []Record{NewInt(1), {Type: TypeInt, Value: "2"}}
+
+	if _, err := Args(invalid); err == nil || !strings.HasPrefix(err.Error(), "argument 0: item 1: type error") {
+		t.Errorf("expected an error for the invalid item, got %v", err)
+	}
+
+	var nilRecord *Record
+
+	if _, err := Args(nilRecord); err == nil {
+		t.Error("expected an error for a nil *Record")
+	}
+
+	// a nil map or slice is sent like an empty one
+	records, err = Args(map[string]any(nil), []any(nil), []Record(nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+
+	if err := WriteRecords(&buffer, records); err != nil {
+		t.Fatal(err)
+	}
+	if encoded := hex.EncodeToString(buffer.Bytes()); encoded != "0383"+"0484"+"0484" {
+		t.Errorf("expected an empty struct and empty arrays, got %s", encoded)
+	}
+}
+
+func TestNewBool(t *testing.T) {
+	for b, expected := range map[bool]string{true: "1001", false: "00"} {
+		var buffer bytes.Buffer
+
+		record := NewBool(b)
+
+		if err := record.Encode(&buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		if hex.EncodeToString(buffer.Bytes()) != expected {
+			t.Errorf("%v: expected %s, got %x", b, expected, buffer.Bytes())
+		}
+	}
+}
+
+func TestStructRecord(t *testing.T) {
+	items := []StructItem{
+		{Key: "a", Value: NewInt(1)},
+		{Key: "a", Value: NewString("b")},
+	}
+
+	for _, test := range []struct {
+		record   Record
+		expected string
+	}{
+		{StructRecord(items), "03" + "256100" + "1001" + "256100" + "216200" + "83"},
+		{NewStruct(items...), "03" + "256100" + "1001" + "256100" + "216200" + "83"},
+		{StructRecord(nil), "0383"},
+		{NewStruct(), "0383"},
+	} {
+		var buffer bytes.Buffer
+
+		if err := test.record.Encode(&buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		if hex.EncodeToString(buffer.Bytes()) != test.expected {
+			t.Errorf("expected %s, got %x", test.expected, buffer.Bytes())
+		}
+	}
+
+	// StructItems is the inverse
+	record := StructRecord(items)
+
+	if decoded, err := record.StructItems(); err != nil || !reflect.DeepEqual(decoded, items) {
+		t.Errorf("expected %v, got %v, %v", items, decoded, err)
+	}
+}
+
+func TestNewDoubleString(t *testing.T) {
+	tests := []struct {
+		f        float64
+		prec     int
+		expected string
+	}{
+		{0.123456789, -1, "0.123456789"},
+		{0.123456789, 4, "0.1235"},
+		{-2.5, -1, "-2.5"},
+		{1e-7, -1, "0.0000001"},
+		{12345678.125, -1, "12345678.125"},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		record := NewDoubleString(test.f, test.prec)
+
+		if err := record.Encode(&buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := ReadRecord(&buffer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, _ := decoded.String()
+
+		if s != test.expected {
+			t.Errorf("%v: expected %s, got %s", test.f, test.expected, s)
+		}
+
+		// Kamailio parses the string with strtod, which round-trips the shortest representation exactly
+		if f, err := strconv.ParseFloat(s, 64); err != nil {
+			t.Error(err)
+		} else if test.prec == -1 && f != test.f {
+			t.Errorf("expected %v, got %v", test.f, f)
+		}
+	}
+}
+
+func TestNewURI(t *testing.T) {
+	for _, uri := range []string{"sip:alice@example.com", "sips:bob@example.com:5061;transport=tls", "SIP:10.0.0.1", "tel:+33123456789"} {
+		record, err := NewURI(uri)
+
+		if err != nil {
+			t.Errorf("%s: %v", uri, err)
+		} else if record.Value != uri {
+			t.Errorf("expected %s, got %v", uri, record.Value)
+		}
+	}
+
+	for _, uri := range []string{"alice@example.com", "http://example.com", "sip:", "sip:alice@example.com\x00;lr", "sip:alice @example.com"} {
+		if _, err := NewURI(uri); err == nil {
+			t.Errorf("%q: expected an error", uri)
+		}
+	}
+}
+
+func TestEncodeNullByte(t *testing.T) {
+	var buffer bytes.Buffer
+
+	// the null byte would truncate the URI on the Kamailio side
+	record := NewString("sip:alice@example.com\x00;lr")
+
+	if err := record.Encode(&buffer); err == nil || !strings.Contains(err.Error(), "null byte") {
+		t.Errorf("expected a null byte error, got %v", err)
+	}
+}
+
+func TestArgsDuration(t *testing.T) {
+	records, err := Args(30*time.Second, 1500*time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// durations are sent in seconds, truncated
+	if records[0].Type != TypeInt || records[0].Value != 30 {
+		t.Errorf("expected int 30, got %v", records[0])
+	}
+	if records[1].Value != 1 {
+		t.Errorf("expected 1, got %v", records[1])
+	}
+
+	if record, err := NewDuration(1500*time.Millisecond, time.Millisecond); err != nil || record.Value != 1500 {
+		t.Errorf("expected 1500, got %v %v", record.Value, err)
+	}
+
+	for _, unit := range []time.Duration{0, -time.Second} {
+		if _, err := NewDuration(time.Second, unit); err == nil {
+			t.Errorf("%v: expected an error for an invalid unit", unit)
+		}
+	}
+
+	if _, err := NewDuration(time.Hour, time.Nanosecond); err == nil {
+		t.Error("expected an error for a duration overflowing 32 bits")
+	}
+}
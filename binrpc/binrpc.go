@@ -7,7 +7,8 @@
 //
 // # Limits
 //
-// The current implementation handles only int, string, and structs containing int or string values. Other types will return an error.
+// The current implementation handles only int, double, string, structs and arrays. Other types will return an error.
+// A Decoder with Opaque set decodes them as records holding their raw value, see OpaqueValue.
 //
 // # Usage
 //
@@ -17,6 +18,8 @@
 //
 // - ReadPacket to read the response
 //
+// - Call to do both, with arguments of any type, and get faults as an *RPCError
+//
 //	package main
 //
 //	import (
@@ -55,7 +58,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
+	"sync/atomic"
 )
 
 // BinRPCMagic is a magic value at the start of every BINRPC packet.
@@ -78,13 +83,59 @@ const (
 	MaxSizeOfLength = 4
 )
 
-// internal error used to detect the end of a struct
-var errEndOfStruct = errors.New("END_OF_STRUCT")
+// TypeName returns the name of the record type t, like "int" for TypeInt, or "unknown" if t is not a type of BINRPC.
+func TypeName(t uint8) string {
+	switch t {
+	case TypeInt:
+		return "int"
+	case TypeString:
+		return "string"
+	case TypeDouble:
+		return "double"
+	case TypeStruct:
+		return "struct"
+	case TypeArray:
+		return "array"
+	case TypeAVP:
+		return "avp"
+	case TypeBytes:
+		return "bytes"
+	}
+
+	return "unknown"
+}
+
+// PacketRequest, PacketReply and PacketFault are the packet types found in the flags of the header.
+const (
+	PacketRequest uint8 = 0x0
+	PacketReply   uint8 = 0x1
+	PacketFault   uint8 = 0x3
+)
+
+// internal errors used to detect the end of a struct or an array
+var (
+	errEndOfStruct = errors.New("END_OF_STRUCT")
+	errEndOfArray  = errors.New("END_OF_ARRAY")
+)
+
+// ErrTruncated is returned when the payload of a packet ends in the middle of a record, like a dump cut before the end
+// of its struct: the response is incomplete and its partial data is not returned.
+//
+// Kamailio does not add an in-band marker to a response that does not fit in its reply buffer: it replies with a fault
+// instead, returned as an *RPCError.
+var ErrTruncated = errors.New("truncated response")
+
+// ErrTextResponse is returned when a response is text instead of a BINRPC packet, like the reply of the FIFO of the
+// ctl module or of the jsonrpcs module: the address is not the binrpc socket of the ctl module.
+var ErrTextResponse = errors.New("text response, not BINRPC")
 
 // Header is a struct containing values needed for parsing the payload and replying. It is not a binary representation of the actual header.
+// Flags is the packet type (PacketRequest, PacketReply or PacketFault), and Version the version of the protocol.
 type Header struct {
 	PayloadLength int
 	Cookie        uint32
+	Flags         uint8
+	Version       uint8
 }
 
 // ValidTypes is an interface of types that can be used in a Record.
@@ -114,223 +165,115 @@ func CreateRecord[T ValidTypes](v T) (*Record, error) {
 
 // ReadHeader is a low level function that reads from r and returns a Header.
 func ReadHeader(r io.Reader) (*Header, error) {
-	buf := make([]byte, 2)
-
-	if len, err := r.Read(buf); err != nil {
-		return nil, fmt.Errorf("cannot read header: %w", err)
-	} else if len != 2 {
-		return nil, fmt.Errorf("cannot read header: read=%d/%d", len, 2)
-	}
-	if magic := buf[0] >> 4; magic != BinRPCMagic {
-		return nil, fmt.Errorf("magic field did not match, expected %X, got %X", BinRPCMagic, magic)
-	}
-
-	if version := buf[0] & 0x0F; version != BinRPCVersion {
-		return nil, fmt.Errorf("version did not match, expected %d, got %d", BinRPCVersion, version)
-	}
-
-	sizeOfLength := buf[1]&0x0C>>2 + 1
-	sizeOfCookie := buf[1]&0x3 + 1
-
-	buf = make([]byte, sizeOfLength)
+	dec := Decoder{r: r}
 
-	if len, err := r.Read(buf); err != nil {
-		return nil, fmt.Errorf("cannot read total length: %w", err)
-	} else if len != int(sizeOfLength) {
-		return nil, fmt.Errorf("cannot read total length, read=%d/%d", len, sizeOfLength)
-	}
-
-	header := Header{}
-
-	for _, b := range buf {
-		header.PayloadLength = header.PayloadLength<<8 + int(b)
-	}
-
-	cookieBytes := make([]byte, sizeOfCookie)
-
-	if len, err := r.Read(cookieBytes); err != nil {
-		return nil, fmt.Errorf("cannot read cookie: %w", err)
-	} else if len != int(sizeOfCookie) {
-		return nil, fmt.Errorf("cannot read cookie, read=%d/%d", len, sizeOfCookie)
-	}
-
-	for _, b := range cookieBytes {
-		header.Cookie = header.Cookie<<8 | uint32(b)
-	}
-
-	return &header, nil
+	return dec.ReadHeader()
 }
 
 // ReadRecord is a low level function that reads from r and returns a Record or an error if one occurred.
 func ReadRecord(r io.Reader) (*Record, error) {
-	record := Record{}
-
-	buf := make([]byte, 1)
+	dec := Decoder{r: r}
 
-	if len, err := r.Read(buf); err != nil {
-		return nil, fmt.Errorf("cannot read record header: %w", err)
-	} else if len != 1 {
-		return nil, fmt.Errorf("cannot read record header: read=%d/1", len)
-	}
+	return dec.ReadRecord()
+}
 
-	flag := buf[0] >> 7
-	size := int(buf[0] >> 4 & 0x7)
+// ReadPacket reads from r and returns records, or an error if one occurred.
+// If expectedCookie is not zero, it verifies the cookie.
+func ReadPacket(r io.Reader, expectedCookie uint32) ([]Record, error) {
+	return NewDecoder(r).ReadPacket(expectedCookie)
+}
 
-	record.size = 1 + size
-	record.Type = buf[0] & 0x0F
+// ReadPacketNoCookie reads from r and returns the records of the next packet, whatever its cookie.
+// It is meant for legacy or non-conformant peers that do not echo the cookie of the request. A response can then not
+// be correlated with its request: the caller must make sure that requests and responses are not interleaved.
+func ReadPacketNoCookie(r io.Reader) ([]Record, error) {
+	return ReadPacket(r, 0)
+}
 
-	if flag == 1 && size == 0 && record.Type == TypeStruct {
-		// this marks the end of a struct
-		return nil, errEndOfStruct
-	}
+// ReadN reads the responses of n requests sent in a row on r, and returns their records in order, whatever their
+// cookies. It is meant for batch scripts writing n requests before reading, when the server answers them in order.
+//
+// A fault is returned as an *RPCError. If the connection breaks or a fault is read, ReadN stops and returns the
+// records of the responses read before with the error, and the next responses are left unread.
+func ReadN(r io.Reader, n int) ([][]Record, error) {
+	dec := NewDecoder(r)
+	responses := make([][]Record, 0, n)
 
-	if flag == 1 {
-		buf = make([]byte, size)
+	for i := 0; i < n; i++ {
+		header, records, err := dec.readPacket(0)
 
-		if len, err := r.Read(buf); err != nil {
-			return nil, fmt.Errorf("cannot read record size: %w", err)
-		} else if len != size {
-			return nil, fmt.Errorf("cannot read record size: read=%d/%d", len, size)
+		if err != nil {
+			return responses, fmt.Errorf("response %d: %w", i, err)
 		}
 
-		size = 0
-		for _, b := range buf {
-			size = size<<8 + int(b)
+		if header.Flags == PacketFault {
+			return responses, fmt.Errorf("response %d: %w", i, newRPCError(records))
 		}
 
-		record.size += size
-	}
-
-	if size == 0 {
-		buf = nil
-	} else {
-		buf = make([]byte, size)
-
-		if len, err := r.Read(buf); err != nil {
-			return nil, fmt.Errorf("cannot read record value: %w", err)
-		} else if len != size {
-			return nil, fmt.Errorf("cannot read record value: read=%d/%d", len, size)
-		}
+		responses = append(responses, records)
 	}
 
-	switch record.Type {
-	case TypeAVP:
-		fallthrough
-	case TypeString:
-		if size == 0 {
-			record.Value = ""
-			break
-		}
-
-		// skip the null byte
-		record.Value = string(buf[0 : len(buf)-1])
-	case TypeInt:
-		record.Value = int(0)
-
-		if size == 0 {
-			break
-		}
-
-		for _, b := range buf {
-			record.Value = record.Value.(int)<<8 + int(b)
-		}
-	case TypeDouble:
-		record.Value = int(0)
-
-		for _, b := range buf {
-			record.Value = record.Value.(int)<<8 + int(b)
-		}
-
-		// double are implemented as int*1000
-		record.Value = float64(record.Value.(int)) / 1000.0
-	case TypeStruct:
-		var items []StructItem
+	return responses, nil
+}
 
-		for {
-			avpName, err := ReadRecord(r)
+// readPacket is like ReadPacket but also returns the header, needed to detect faults.
+func readPacket(r io.Reader, expectedCookie uint32) (*Header, []Record, error) {
+	return NewDecoder(r).readPacket(expectedCookie)
+}
 
-			if err == errEndOfStruct {
-				record.size++
-				break
-			} else if err != nil {
-				return nil, err
-			}
+// ReadPayload reads extactly payloadLength bytes from r and returns records, or an error if one occurred.
+func ReadPayload(r io.Reader, payloadLength int) ([]Record, error) {
+	dec := Decoder{r: r}
 
-			if avpName.Type != TypeAVP {
-				return nil, fmt.Errorf("struct contains something else than avp: %d", avpName.Type)
-			}
+	return dec.ReadPayload(payloadLength)
+}
 
-			record.size += avpName.size
+// WriteRecords encodes records in sequence and writes them to w, without the header of a packet. It is the inverse
+// of ReadPayload, for custom framing. Nothing is written if a record cannot be encoded.
+func WriteRecords(w io.Writer, records []Record) error {
+	var payload bytes.Buffer
 
-			avpValue, err := ReadRecord(r)
+	if err := encodeRecords(&payload, records); err != nil {
+		return err
+	}
 
-			if err != nil {
-				return nil, err
-			}
+	_, err := w.Write(payload.Bytes())
 
-			items = append(items, StructItem{
-				Key:   avpName.Value.(string),
-				Value: *avpValue,
-			})
+	return err
+}
 
-			record.size += avpValue.size
+// encodeRecords encodes records in sequence into payload.
+func encodeRecords(payload *bytes.Buffer, records []Record) error {
+	for _, record := range records {
+		if err := record.Encode(payload); err != nil {
+			return err
 		}
-
-		record.Value = items
-	default:
-		return nil, fmt.Errorf("type error: type %d not implemented", record.Type)
 	}
 
-	return &record, nil
+	return nil
 }
 
-// ReadPacket reads from r and returns records, or an error if one occurred.
-// If expectedCookie is not zero, it verifies the cookie.
-func ReadPacket(r io.Reader, expectedCookie uint32) ([]Record, error) {
-	bufreader := bufio.NewReader(r)
-	header, err := ReadHeader(bufreader)
-
-	if err != nil {
-		return nil, err
-	}
+// lastCookie is the last cookie generated, starting at a random value.
+var lastCookie atomic.Uint32
 
-	if expectedCookie != 0 && expectedCookie != header.Cookie {
-		return nil, errors.New("expected cookie did not match")
-	}
-
-	return ReadPayload(bufreader, header.PayloadLength)
+func init() {
+	lastCookie.Store(rand.Uint32())
 }
 
-// ReadPayload reads extactly payloadLength bytes from r and returns records, or an error if one occurred.
-func ReadPayload(r io.Reader, payloadLength int) ([]Record, error) {
-	payloadBytes := make([]byte, payloadLength)
-	_, err := io.ReadFull(r, payloadBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	read := 0
-	payload := bytes.NewReader(payloadBytes)
-	records := []Record{}
-
-	for read < payloadLength {
-		record, err := ReadRecord(payload)
-
-		if err != nil {
-			return nil, err
+// newCookie returns a new cookie. Cookies are incremented atomically, so concurrent calls never get the same cookie
+// before 2^32-1 cookies are generated. Zero is skipped, as it disables the verification of the cookie.
+func newCookie() uint32 {
+	for {
+		if cookie := lastCookie.Add(1); cookie != 0 {
+			return cookie
 		}
-
-		records = append(records, *record)
-		read += record.size
 	}
-
-	return records, err
 }
 
 // WritePacket creates a BINRPC packet (header and payload) containing values v, and writes it to w.
 // It returns the cookie generated, or an error if one occurred.
 func WritePacket[T ValidTypes](w io.Writer, values ...T) (uint32, error) {
-	cookie := rand.Uint32()
+	cookie := newCookie()
 	if err := WritePacketWithCookie(cookie, w, values...); err != nil {
 		return 0, err
 	}
@@ -344,8 +287,7 @@ func WritePacketWithCookie[T ValidTypes](cookie uint32, w io.Writer, values ...T
 		return errors.New("missing values")
 	}
 
-	var header bytes.Buffer
-	var payload bytes.Buffer
+	records := make([]Record, 0, len(values))
 
 	for _, v := range values {
 		record, err := CreateRecord(v)
@@ -354,21 +296,39 @@ func WritePacketWithCookie[T ValidTypes](cookie uint32, w io.Writer, values ...T
 			return err
 		}
 
-		if err = record.Encode(&payload); err != nil {
-			return err
-		}
+		records = append(records, *record)
+	}
+
+	return writePacket(w, cookie, PacketRequest, records)
+}
+
+// writePacket encodes records in a packet of type flags, and writes it to w.
+func writePacket(w io.Writer, cookie uint32, flags uint8, records []Record) error {
+	var header bytes.Buffer
+	var payload bytes.Buffer
+
+	if err := encodeRecords(&payload, records); err != nil {
+		return err
 	}
 
-	lengthBE := intToBytesBE(payload.Len())
+	lengthBE, err := sizeToBytesBE(payload.Len())
 
-	if len(lengthBE) > MaxSizeOfLength {
-		return fmt.Errorf("packet length too big: %d/%d bytes", len(lengthBE), MaxSizeOfLength)
+	if err != nil {
+		return fmt.Errorf("packet length too big: %w", err)
 	}
 
-	cookieBytes := intToBytesBE(int(cookie))
+	cookieBytes := intToBytesBE(cookie)
+
+	// lengths are written as "length-1", so at least one byte is needed
+	if len(lengthBE) == 0 {
+		lengthBE = []byte{0x00}
+	}
+	if len(cookieBytes) == 0 {
+		cookieBytes = []byte{0x00}
+	}
 
 	header.WriteByte(BinRPCMagic<<4 | BinRPCVersion)
-	header.WriteByte(byte((len(lengthBE)-1)<<2 | len(cookieBytes) - 1))
+	header.WriteByte(flags<<4 | byte((len(lengthBE)-1)<<2|(len(cookieBytes)-1)))
 	header.Write(lengthBE)
 	header.Write(cookieBytes)
 
@@ -388,8 +348,8 @@ func WritePacketWithCookie[T ValidTypes](cookie uint32, w io.Writer, values ...T
 }
 
 // getMinBinarySizeOfInt returns the minimum size in bytes required to store an integer.
-func getMinBinarySizeOfInt(value int) uint8 {
-	n := uint32(value)
+func getMinBinarySizeOfInt(value uint32) uint8 {
+	n := value
 	size := uint8(0)
 
 	for size = 4; size > 0 && ((n & (0xff << 24)) == 0); size-- {
@@ -399,7 +359,9 @@ func getMinBinarySizeOfInt(value int) uint8 {
 	return size
 }
 
-func intToBytesBE(n int) []byte {
+// intToBytesBE returns n in big endian, on the minimum number of bytes. Ints are 32 bits on the wire whatever the
+// size of int on the platform.
+func intToBytesBE(n uint32) []byte {
 	size := getMinBinarySizeOfInt(n)
 	bytes := make([]byte, size)
 
@@ -411,3 +373,23 @@ func intToBytesBE(n int) []byte {
 
 	return bytes
 }
+
+// sizeToBytesBE returns size, a length of packet or of record value, in big endian. Sizes are limited to 32 bits on the
+// wire, a bigger size returns an error instead of being truncated.
+func sizeToBytesBE(size int) ([]byte, error) {
+	if uint64(size) > math.MaxUint32 {
+		return nil, fmt.Errorf("size %d does not fit in 32 bits", size)
+	}
+
+	return intToBytesBE(uint32(size)), nil
+}
+
+// intToUint32 returns the 32 bits of v to write on the wire. Kamailio reads them as a signed int: values up to
+// math.MaxUint32 are accepted for flags and bit masks, but are read back as negative above math.MaxInt32.
+func intToUint32(v int64) (uint32, error) {
+	if v < math.MinInt32 || v > math.MaxUint32 {
+		return 0, fmt.Errorf("int %d does not fit in 32 bits", v)
+	}
+
+	return uint32(v), nil
+}
@@ -3,8 +3,15 @@ package binrpc
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -25,6 +32,10 @@ func TestReadHeader(t *testing.T) {
 	if header.PayloadLength != 0x0b {
 		t.Errorf("wrong payload length, expected %d, got %d", 0x0b, header.PayloadLength)
 	}
+
+	if header.Version != BinRPCVersion {
+		t.Errorf("wrong version, expected %d, got %d", BinRPCVersion, header.Version)
+	}
 }
 
 func TestReadHeaderInvalid(t *testing.T) {
@@ -42,6 +53,22 @@ func TestReadHeaderInvalid(t *testing.T) {
 	}
 }
 
+func TestReadHeaderText(t *testing.T) {
+	// the reply of the FIFO protocol, and of jsonrpcs
+	for _, response := range []string{"200 ok\nkamailio 5.7.4\n", "500 command not found\n", `{"jsonrpc": "2.0"}`} {
+		_, err := ReadPacket(strings.NewReader(response), 0)
+
+		if !errors.Is(err, ErrTextResponse) || !strings.Contains(err.Error(), "FIFO") {
+			t.Errorf("%q: expected ErrTextResponse, got %v", response, err)
+		}
+	}
+
+	// binary garbage is still an invalid magic
+	if _, err := ReadPacket(bytes.NewReader([]byte{0xff, 0x00}), 0); err == nil || errors.Is(err, ErrTextResponse) {
+		t.Errorf("expected an invalid magic, got %v", err)
+	}
+}
+
 func TestReadRecordString(t *testing.T) {
 	data := []byte{0x91, 0x09, 0x74, 0x6d, 0x2e, 0x73, 0x74, 0x61, 0x74, 0x73, 0x00}
 	reader := bytes.NewReader(data)
@@ -122,7 +149,7 @@ func TestWritePacket(t *testing.T) {
 		t.Error(err)
 	}
 
-	cookieLength := int(getMinBinarySizeOfInt(int(cookie)))
+	cookieLength := int(getMinBinarySizeOfInt(cookie))
 	expectedLength := len(expectedHeader) + len(expectedRecord) + cookieLength
 	if buffer.Len() != expectedLength {
 		t.Errorf("output length mismatch, expected %d, got %d", expectedLength, buffer.Len())
@@ -145,6 +172,51 @@ func TestWritePacket(t *testing.T) {
 	}
 }
 
+func TestWriteRecords(t *testing.T) {
+	records := []Record{
+		NewString("tm.stats"),
+		NewInt(-1),
+		NewDouble(1.5),
+		{Type: TypeStruct, Value: []StructItem{{Key: "size", Value: NewInt(7)}}},
+		{Type: TypeArray, Value: []Record{NewString("a"), NewInt(2)}},
+	}
+
+	var buffer bytes.Buffer
+
+	if err := WriteRecords(&buffer, records); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(buffer.Bytes(), []byte{0x91, 0x09}) {
+		t.Errorf("expected no packet header, got %x", buffer.Bytes())
+	}
+
+	decoded, err := ReadPayload(&buffer, buffer.Len())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(decoded))
+	}
+
+	for i := range records {
+		if !decoded[i].Equal(records[i]) {
+			t.Errorf("record %d: expected %v, got %v", i, records[i], decoded[i])
+		}
+	}
+
+	buffer.Reset()
+
+	if err := WriteRecords(&buffer, []Record{NewString("a"), {Type: TypeInt, Value: "1"}}); err == nil {
+		t.Error("expected an error for an invalid record")
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected nothing written, got %x", buffer.Bytes())
+	}
+}
+
 func TestWritePacketInt(t *testing.T) {
 	expectedHeader, _ := hex.DecodeString("a10302")
 	expectedRecord, _ := hex.DecodeString("108e")
@@ -157,7 +229,7 @@ func TestWritePacketInt(t *testing.T) {
 		t.Error(err)
 	}
 
-	cookieLength := int(getMinBinarySizeOfInt(int(cookie)))
+	cookieLength := int(getMinBinarySizeOfInt(cookie))
 	expectedLength := len(expectedHeader) + len(expectedRecord) + cookieLength
 	if buffer.Len() != expectedLength {
 		t.Errorf("output length mismatch, expected %d, got %d", expectedLength, buffer.Len())
@@ -188,6 +260,59 @@ func TestMinBinarySizeOfInt(t *testing.T) {
 	}
 }
 
+func TestEncode32Bits(t *testing.T) {
+	tests := []struct {
+		record Record
+		hex    string
+	}{
+		{NewInt(2147483647), "407fffffff"},
+		{NewInt(-1), "40ffffffff"},
+		{NewInt(-2147483648), "4080000000"},
+		{NewDouble(-1.5), "42fffffa24"},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		if err := test.record.Encode(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		if encoded := hex.EncodeToString(buffer.Bytes()); encoded != test.hex {
+			t.Errorf("%v: expected %s, got %s", test.record.Value, test.hex, encoded)
+		}
+
+		// negative values are sign extended, the same on every platform
+		decoded, err := ReadRecord(&buffer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Equal(test.record) {
+			t.Errorf("expected %v, got %v", test.record.Value, decoded.Value)
+		}
+	}
+
+	double := NewDouble(5e6)
+
+	if err := double.Encode(io.Discard); err == nil {
+		t.Error("expected an error for a double out of 32 bits")
+	}
+
+	// sizes and ints beyond 32 bits can only be tested where int is 64 bits, they cannot be built on 32-bit platforms
+	if strconv.IntSize < 64 {
+		t.Skip("int is 32 bits")
+	}
+
+	var big int64 = 1 << 32
+
+	if _, err := sizeToBytesBE(int(big)); err == nil {
+		t.Error("expected an error for a size out of 32 bits")
+	}
+	if record := NewInt(int(big)); record.Encode(io.Discard) == nil {
+		t.Error("expected an error for an int out of 32 bits")
+	}
+}
+
 func TestCreateRecord(t *testing.T) {
 	record, err := CreateRecord(42)
 
@@ -280,6 +405,268 @@ func TestTypeDouble(t *testing.T) {
 	}
 }
 
+func TestNegativeRoundTrip(t *testing.T) {
+	tests := []struct {
+		record   Record
+		hex      string
+		expected any
+	}{
+		{NewDouble(-1.5), "42fffffa24", -1.5},
+		{NewDouble(-0.001), "42ffffffff", -0.001},
+		{NewDouble(-2147483.648), "4280000000", -2147483.648},
+		{NewDouble(2147483.647), "427fffffff", 2147483.647},
+		{NewDouble(-1000000.25), "42c4653506", -1000000.25},
+		// like Kamailio, the thousandths are truncated towards zero
+		{NewDouble(-1.0009), "42fffffc18", -1.0},
+		{NewInt(-42), "40ffffffd6", -42},
+		{NewInt(-2147483648), "4080000000", -2147483648},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		if err := test.record.Encode(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		if encoded := hex.EncodeToString(buffer.Bytes()); encoded != test.hex {
+			t.Errorf("%v: expected %s, got %s", test.record.Value, test.hex, encoded)
+		}
+
+		decoded, err := ReadRecord(&buffer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Value != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.record.Value, test.expected, decoded.Value)
+		}
+	}
+
+	for _, v := range []float64{-2147483.649, 2147483.648, 3000000.5, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		double := NewDouble(v)
+
+		if err := double.Encode(io.Discard); err == nil {
+			t.Errorf("%v: expected an error for a double out of the range of 32 bits", v)
+		}
+	}
+}
+
+type testURI struct {
+	User string
+	Host string
+}
+
+func TestScanWith(t *testing.T) {
+	record, _ := CreateRecord("sip:alice@example.com")
+
+	converters := Converters{
+		reflect.TypeOf((*testURI)(nil)): func(record *Record, dest any) error {
+			s, err := record.String()
+
+			if err != nil {
+				return err
+			}
+
+			user, host, ok := strings.Cut(strings.TrimPrefix(s, "sip:"), "@")
+
+			if !ok {
+				return fmt.Errorf("invalid uri: %s", s)
+			}
+
+			*dest.(*testURI) = testURI{User: user, Host: host}
+
+			return nil
+		},
+	}
+
+	var uri testURI
+
+	if err := record.ScanWith(&uri, converters); err != nil {
+		t.Error(err)
+	}
+	if uri.User != "alice" || uri.Host != "example.com" {
+		t.Errorf("unexpected uri %+v", uri)
+	}
+
+	// types without a converter use the built-in conversions
+	var s string
+
+	if err := record.ScanWith(&s, converters); err != nil {
+		t.Error(err)
+	}
+	if s != "sip:alice@example.com" {
+		t.Errorf(`expected "sip:alice@example.com", got "%s"`, s)
+	}
+
+	if err := record.ScanWith(&uri, nil); err == nil {
+		t.Error("expected an error without converter")
+	}
+}
+
+func TestRecordShape(t *testing.T) {
+	// core.shmmem response
+	raw := "a11350123456780365746f74616c0040020000005566726565004001c9c380557573656400301e8480950a7265616c5f757365640030363c8095096d61785f75736564003036ee80950a667261676d656e747300105083"
+	data, _ := hex.DecodeString(raw)
+
+	records, err := ReadPacket(bytes.NewReader(data), 0x12345678)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if !records[0].IsStruct() || records[0].IsArray() || records[0].IsScalar() {
+		t.Error("expected a struct")
+	}
+
+	items, _ := records[0].StructItems()
+
+	if len(items) != 6 || items[0].Key != "total" || items[0].Value.Value != 33554432 {
+		t.Errorf("unexpected items %v", items)
+	}
+
+	// a scalar followed by a struct and an array
+	mixed := []Record{
+		{Type: TypeInt, Value: 2},
+		records[0],
+		{Type: TypeArray, Value: []Record{}},
+	}
+
+	var buffer bytes.Buffer
+
+	if err := writePacket(&buffer, 1, PacketReply, mixed); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err = ReadPacket(&buffer, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	if !records[0].IsScalar() || !records[1].IsStruct() || !records[2].IsArray() {
+		t.Errorf("unexpected shapes %v", records)
+	}
+}
+
+func TestReadPacketNoCookie(t *testing.T) {
+	// response with a zero cookie
+	data, _ := hex.DecodeString("a1100200102a")
+
+	if _, err := ReadPacket(bytes.NewReader(data), 0x9883af); err == nil {
+		t.Error("expected a cookie mismatch")
+	}
+
+	records, err := ReadPacketNoCookie(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != 42 {
+		t.Errorf("unexpected records %v", records)
+	}
+}
+
+func TestReadN(t *testing.T) {
+	var buffer bytes.Buffer
+
+	// 3 pipelined responses, written in one go like the server answering in order
+	for i := 1; i <= 3; i++ {
+		if err := writePacket(&buffer, uint32(i), PacketReply, []Record{NewInt(i), NewString("ok")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := buffer.Bytes()
+	responses, err := ReadN(bytes.NewReader(data), 3)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(responses))
+	}
+
+	for i, records := range responses {
+		if records[0].Value != i+1 || records[1].Value != "ok" {
+			t.Errorf("response %d: unexpected records %v", i, records)
+		}
+	}
+
+	// the connection breaks in the middle of the third response
+	responses, err = ReadN(bytes.NewReader(data[:len(data)-2]), 3)
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if len(responses) != 2 {
+		t.Errorf("expected 2 responses, got %d", len(responses))
+	}
+
+	// a fault stops reading
+	buffer.Reset()
+	writePacket(&buffer, 1, PacketReply, []Record{NewInt(1)})
+	writePacket(&buffer, 2, PacketFault, []Record{NewInt(500), NewString("command core.bogus not found")})
+
+	var rpcErr *RPCError
+
+	if responses, err = ReadN(&buffer, 2); !errors.As(err, &rpcErr) || len(responses) != 1 {
+		t.Errorf("expected 1 response and an *RPCError, got %d and %v", len(responses), err)
+	}
+}
+
+func TestNewCookieConcurrent(t *testing.T) {
+	const goroutines = 64
+	const cookies = 1000
+
+	var wg sync.WaitGroup
+
+	results := make([][]uint32, goroutines)
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < cookies; j++ {
+				results[i] = append(results[i], newCookie())
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	seen := map[uint32]bool{}
+
+	for _, result := range results {
+		for _, cookie := range result {
+			if cookie == 0 {
+				t.Fatal("cookie must not be zero")
+			}
+			if seen[cookie] {
+				t.Fatalf("duplicate cookie %x", cookie)
+			}
+
+			seen[cookie] = true
+		}
+	}
+}
+
+func TestNewCookieSkipsZero(t *testing.T) {
+	previous := lastCookie.Load()
+	defer lastCookie.Store(previous)
+
+	lastCookie.Store(0xFFFFFFFF)
+
+	if cookie := newCookie(); cookie != 1 {
+		t.Errorf("expected cookie 1, got %d", cookie)
+	}
+}
+
 func ExampleWritePacket() {
 	// establish connection to Kamailio server
 	conn, err := net.Dial("tcp", "localhost:2049")
@@ -421,3 +808,28 @@ func ExampleWritePacket_structResponseScan() {
 		)
 	}
 }
+
+func TestTypeName(t *testing.T) {
+	names := map[uint8]string{
+		TypeInt:    "int",
+		TypeString: "string",
+		TypeDouble: "double",
+		TypeStruct: "struct",
+		TypeArray:  "array",
+		TypeAVP:    "avp",
+		TypeBytes:  "bytes",
+		7:          "unknown",
+		0xff:       "unknown",
+	}
+
+	for typ, name := range names {
+		if s := TypeName(typ); s != name {
+			t.Errorf("%d: expected %s, got %s", typ, name, s)
+		}
+	}
+
+	// error messages name the types
+	if _, err := NewInt(1).String(); err == nil || err.Error() != "type error: expected type string (1), got int (0)" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package binrpc
+
+import (
+	"bytes"
+	"io"
+)
+
+// ArrayBuilder builds an array Record incrementally: each item is encoded as soon as it is added, so a large array
+// argument does not need a []Record of all its items.
+//
+//	var builder binrpc.ArrayBuilder
+//
+//	for _, uri := range uris {
+//		if err := builder.Add(binrpc.NewString(uri)); err != nil {
+//			return err
+//		}
+//	}
+//
+//	records, err := binrpc.Call(conn, method, builder.Record())
+type ArrayBuilder struct {
+	buffer bytes.Buffer
+	len    int
+}
+
+// Add encodes record and appends it to the array.
+func (builder *ArrayBuilder) Add(record Record) error {
+	if err := record.Encode(&builder.buffer); err != nil {
+		return err
+	}
+
+	builder.len++
+
+	return nil
+}
+
+// Len returns the number of items added to the array.
+func (builder *ArrayBuilder) Len() int {
+	return builder.len
+}
+
+// Record returns the array Record with the items added so far. Its value holds the encoded items: it is written as is
+// by Encode, and decoded again by Array, ToGo, Equal and Dump.
+func (builder *ArrayBuilder) Record() Record {
+	return Record{Type: TypeArray, Value: encodedItems(builder.buffer.Bytes())}
+}
+
+// encodedItems is the value of an array Record with items already encoded, without the start and end markers.
+type encodedItems []byte
+
+// decode returns the records encoded in items.
+func (items encodedItems) decode() ([]Record, error) {
+	dec := Decoder{r: bytes.NewReader(items)}
+	records := []Record{}
+
+	for {
+		record, err := dec.ReadRecord()
+
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		records = append(records, *record)
+	}
+}
@@ -0,0 +1,108 @@
+package binrpc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestArrayBuilder(t *testing.T) {
+	var builder ArrayBuilder
+
+	items := []Record{}
+
+	for i := 0; i < 1000; i++ {
+		item := Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "uri", Value: NewString(fmt.Sprintf("sip:10.0.0.%d:5060", i%256))},
+			{Key: "weight", Value: NewInt(i)},
+		}}
+
+		if err := builder.Add(item); err != nil {
+			t.Fatal(err)
+		}
+
+		items = append(items, item)
+	}
+
+	if builder.Len() != 1000 {
+		t.Errorf("expected 1000 items, got %d", builder.Len())
+	}
+
+	var incremental, oneShot bytes.Buffer
+
+	record := builder.Record()
+
+	if err := record.Encode(&incremental); err != nil {
+		t.Fatal(err)
+	}
+
+	array := Record{Type: TypeArray, Value: items}
+
+	if err := array.Encode(&oneShot); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(incremental.Bytes(), oneShot.Bytes()) {
+		t.Error("incremental and one-shot encodings differ")
+	}
+
+	decoded, err := record.Array()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1000 || !decoded[999].Equal(items[999]) {
+		t.Error("decoded items differ")
+	}
+}
+
+func TestArrayBuilderCall(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, request[1:]
+	})
+
+	var builder ArrayBuilder
+
+	builder.Add(NewInt(1))
+	builder.Add(NewString("two"))
+
+	records, err := Call(conn, "core.echo", builder.Record())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Record{Type: TypeArray, Value: []Record{NewInt(1), NewString("two")}}
+
+	if !records[0].Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, records[0])
+	}
+
+	if err := builder.Add(Record{Type: TypeInt, Value: "not an int"}); err == nil {
+		t.Error("expected an error for an invalid record")
+	}
+	if builder.Len() != 2 {
+		t.Errorf("an invalid record must not be counted, got %d items", builder.Len())
+	}
+}
+
+func TestArrayBuilderRecord(t *testing.T) {
+	var builder ArrayBuilder
+
+	builder.Add(NewInt(1))
+	builder.Add(NewString("two"))
+
+	record := builder.Record()
+	expected := Record{Type: TypeArray, Value: []Record{NewInt(1), NewString("two")}}
+
+	if !record.Equal(expected) || !expected.Equal(record) {
+		t.Errorf("expected %v to equal %v", record, expected)
+	}
+	if !reflect.DeepEqual(record.ToGo(), []any{1, "two"}) {
+		t.Errorf("unexpected value %#v", record.ToGo())
+	}
+	if dump := Dump([]Record{record}); dump != Dump([]Record{expected}) {
+		t.Errorf("unexpected dump %q", dump)
+	}
+}
@@ -0,0 +1,163 @@
+package binrpc
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is a Middleware memoizing the responses of idempotent read methods, like "core.version" or
+// "dispatcher.list", to reduce the load of frequently polled reads on Kamailio:
+//
+//	cache := binrpc.NewCache(10*time.Second, 100, "core.version", "dispatcher.list")
+//	client.Use(cache.Middleware)
+//
+// Only the methods given to NewCache are cached, the other calls, like writes and reloads, bypass the cache. A
+// response is cached for a request, the method and its encoded arguments, until its TTL expires. Faults and errors
+// are not cached. The records of a cached response are shared by the calls returning it, and must not be modified.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	methods    map[string]bool
+	clock      Clock
+
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+	hits    int
+	misses  int
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	records []Record
+	expires time.Time
+}
+
+// CacheStats are the counters of a Cache. Hits and Misses count the calls of the cached methods, returned from the
+// cache or not.
+type CacheStats struct {
+	Hits    int
+	Misses  int
+	Entries int
+}
+
+// NewCache returns a Cache of the responses of methods, for ttl, holding at most maxEntries responses. When it is
+// full, the response expiring first is evicted. A maxEntries of 0 does not limit the number of responses.
+func NewCache(ttl time.Duration, maxEntries int, methods ...string) *Cache {
+	cache := Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		methods:    map[string]bool{},
+		clock:      realClock{},
+		entries:    map[string]cacheEntry{},
+	}
+
+	for _, method := range methods {
+		cache.methods[method] = true
+	}
+
+	return &cache
+}
+
+// Middleware returns the responses of the cached methods from the cache, or calls next and caches its response.
+func (cache *Cache) Middleware(next CallFunc) CallFunc {
+	return func(ctx context.Context, method string, args []Record) ([]Record, error) {
+		if !cache.methods[method] {
+			return next(ctx, method, args)
+		}
+
+		key, err := cacheKey(method, args)
+
+		if err != nil {
+			return next(ctx, method, args)
+		}
+
+		if records, ok := cache.get(key); ok {
+			return records, nil
+		}
+
+		records, err := next(ctx, method, args)
+
+		if err == nil {
+			cache.put(key, records)
+		}
+
+		return records, err
+	}
+}
+
+// Stats returns the counters of the cache.
+func (cache *Cache) Stats() CacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return CacheStats{Hits: cache.hits, Misses: cache.misses, Entries: len(cache.entries)}
+}
+
+// Purge removes all the responses from the cache.
+func (cache *Cache) Purge() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	clear(cache.entries)
+}
+
+// cacheKey returns the key of a request, the encoding of the method and its arguments.
+func cacheKey(method string, args []Record) (string, error) {
+	var key bytes.Buffer
+
+	if err := WriteRecords(&key, append([]Record{NewString(method)}, args...)); err != nil {
+		return "", err
+	}
+
+	return key.String(), nil
+}
+
+// get returns the response cached for key, if it has not expired.
+func (cache *Cache) get(key string) ([]Record, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[key]
+
+	if ok && !cache.clock.Now().Before(entry.expires) {
+		delete(cache.entries, key)
+		ok = false
+	}
+
+	if !ok {
+		cache.misses++
+		return nil, false
+	}
+
+	cache.hits++
+
+	return entry.records, true
+}
+
+// put caches records for key, evicting the expired responses, and the one expiring first if the cache is full.
+func (cache *Cache) put(key string, records []Record) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := cache.clock.Now()
+
+	if _, ok := cache.entries[key]; !ok && cache.maxEntries > 0 && len(cache.entries) >= cache.maxEntries {
+		var first string
+
+		for k, entry := range cache.entries {
+			if !now.Before(entry.expires) {
+				delete(cache.entries, k)
+			} else if first == "" || entry.expires.Before(cache.entries[first].expires) {
+				first = k
+			}
+		}
+
+		if len(cache.entries) >= cache.maxEntries {
+			delete(cache.entries, first)
+		}
+	}
+
+	cache.entries[key] = cacheEntry{records: records, expires: now.Add(cache.ttl)}
+}
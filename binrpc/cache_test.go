@@ -0,0 +1,93 @@
+package binrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache := NewCache(10*time.Second, 2, "core.version", "dispatcher.list")
+	cache.clock = clock
+
+	calls := 0
+
+	call := cache.Middleware(func(ctx context.Context, method string, args []Record) ([]Record, error) {
+		calls++
+
+		if method == "core.bogus" {
+			return nil, &RPCError{Code: 500, Message: "command core.bogus not found"}
+		}
+
+		return []Record{NewString(method), NewInt(calls)}, nil
+	})
+
+	version := func() int {
+		records, err := call(context.Background(), "core.version", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return records[1].IntOr(0)
+	}
+
+	if n := version(); n != 1 {
+		t.Errorf("expected the first call, got %d", n)
+	}
+
+	clock.Advance(9 * time.Second)
+
+	if n := version(); n != 1 {
+		t.Errorf("expected the cached response, got %d", n)
+	}
+
+	clock.Advance(time.Second)
+
+	if n := version(); n != 2 {
+		t.Errorf("expected a new call after the TTL, got %d", n)
+	}
+
+	if stats := cache.Stats(); stats != (CacheStats{Hits: 1, Misses: 2, Entries: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// the arguments are part of the key
+	for _, set := range []int{1, 2, 1} {
+		clock.Advance(time.Second)
+
+		if _, err := call(context.Background(), "dispatcher.list", []Record{NewInt(set)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 4 {
+		t.Errorf("expected 4 calls, got %d", calls)
+	}
+
+	// the cache is full, the response expiring first was evicted
+	if n := version(); n != 5 {
+		t.Errorf("expected a new call after the eviction, got %d", n)
+	}
+
+	if stats := cache.Stats(); stats != (CacheStats{Hits: 2, Misses: 5, Entries: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// other methods and faults are not cached
+	for i := 0; i < 2; i++ {
+		_, _ = call(context.Background(), "dispatcher.reload", nil)
+		_, _ = call(context.Background(), "core.bogus", nil)
+	}
+
+	if calls != 9 {
+		t.Errorf("expected 9 calls, got %d", calls)
+	}
+
+	cache.Purge()
+
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("expected an empty cache, got %+v", stats)
+	}
+}
@@ -0,0 +1,365 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Fault codes used by Kamailio. There is no dedicated code for an unknown method: the ctl module replies with
+// FaultInternalError and a message like "command core.bogus not found", and the jsonrpcs module with "Method Not
+// Found", both detected as ErrMethodNotFound.
+const (
+	FaultInvalidParameters = 400
+	FaultNotFound          = 404
+	FaultInternalError     = 500
+)
+
+// FaultName returns a short description of a fault code, like "invalid parameters" for 400, or "unknown" if the
+// code is not one of the fault codes used by Kamailio.
+func FaultName(code int) string {
+	switch code {
+	case FaultInvalidParameters:
+		return "invalid parameters"
+	case FaultNotFound:
+		return "not found"
+	case FaultInternalError:
+		return "internal error"
+	}
+
+	return "unknown"
+}
+
+// RPCError is returned when Kamailio replies with a fault, like an unknown command or invalid parameters.
+type RPCError struct {
+	Code    int
+	Message string
+}
+
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("rpc fault %d (%s): %s", err.Code, FaultName(err.Code), err.Message)
+}
+
+// ErrMethodNotFound matches with errors.Is the *RPCError returned when the method does not exist, like a method of a
+// module not loaded or of another version of Kamailio.
+//
+//	if errors.Is(err, binrpc.ErrMethodNotFound) {
+//		// fall back to another method
+//	}
+var ErrMethodNotFound = errors.New("method not found")
+
+// Is reports whether target is ErrMethodNotFound and the fault is the one of an unknown method.
+func (err *RPCError) Is(target error) bool {
+	if target != ErrMethodNotFound || err.Code != FaultInternalError {
+		return false
+	}
+
+	return err.Message == "Method Not Found" ||
+		strings.HasPrefix(err.Message, "command ") && strings.HasSuffix(err.Message, " not found")
+}
+
+// Call invokes method with args on the connection rw: it writes the request, then reads and returns the records of the
+// response. A fault response is returned as an *RPCError.
+//
+// Call is not safe for concurrent use on the same rw: the requests and responses of concurrent calls would be
+// interleaved, and a call could read the response of another one. Serialize the calls on a connection, or use a Client,
+// safe for concurrent use.
+//
+// On a connection returned by NewConn, the records are passed to its Transport without being encoded.
+//
+// Call works with any RPC method, including those without a typed helper in this package. Arguments of any type,
+// like int and string mixed together, are passed as records:
+//
+//	records, err := binrpc.Call(conn, "htable.seti",
+//		binrpc.Record{Type: binrpc.TypeString, Value: "table"},
+//		binrpc.Record{Type: binrpc.TypeString, Value: "key"},
+//		binrpc.Record{Type: binrpc.TypeInt, Value: 42},
+//	)
+func Call(rw io.ReadWriter, method string, args ...Record) ([]Record, error) {
+	if caller, ok := rw.(recordCaller); ok {
+		return caller.callRecords(method, args)
+	}
+
+	cookie, err := writeRequest(rw, method, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readResponse(rw, cookie)
+}
+
+// CallOne is like Call, for a method returning exactly one record: it returns this record, or an error if the response
+// has no record or several records. A fault response is returned as an *RPCError.
+func CallOne(rw io.ReadWriter, method string, args ...Record) (*Record, error) {
+	records, err := Call(rw, method, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(records) {
+	case 1:
+		return &records[0], nil
+	case 0:
+		return nil, fmt.Errorf("%s: empty response", method)
+	default:
+		return nil, fmt.Errorf("%s: %d records in response, expected 1", method, len(records))
+	}
+}
+
+// CallInt is like CallOne, for a method returning a single int:
+//
+//	n, err := binrpc.CallInt(conn, "core.ppid")
+//
+// It returns an error if the response is not exactly one int record.
+func CallInt(rw io.ReadWriter, method string, args ...Record) (int, error) {
+	record, err := CallOne(rw, method, args...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := record.Int()
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", method, err)
+	}
+
+	return i, nil
+}
+
+// CallString is like CallOne, for a method returning a single string. It returns an error if the response is not
+// exactly one string record.
+func CallString(rw io.ReadWriter, method string, args ...Record) (string, error) {
+	record, err := CallOne(rw, method, args...)
+
+	if err != nil {
+		return "", err
+	}
+
+	s, err := record.String()
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", method, err)
+	}
+
+	return s, nil
+}
+
+// CallDouble is like CallOne, for a method returning a single double. It returns an error if the response is not
+// exactly one double record.
+func CallDouble(rw io.ReadWriter, method string, args ...Record) (float64, error) {
+	record, err := CallOne(rw, method, args...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := record.Double()
+
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", method, err)
+	}
+
+	return f, nil
+}
+
+// CallInto invokes method with args converted by Args, and scans the record of the response into dest with Scan:
+//
+//	var shmmem binrpc.SHMMem
+//	err := binrpc.CallInto(conn, &shmmem, "core.shmmem")
+//
+// The response must have one record. A response with several top level records, like a list of structs, is scanned
+// as an array when dest is a pointer to a slice.
+func CallInto(rw io.ReadWriter, dest any, method string, args ...any) error {
+	records, err := Args(args...)
+
+	if err != nil {
+		return err
+	}
+
+	if records, err = Call(rw, method, records...); err != nil {
+		return err
+	}
+
+	var record Record
+
+	v := reflect.ValueOf(dest)
+
+	switch {
+	case len(records) == 1:
+		record = records[0]
+	case len(records) > 1 && v.Kind() == reflect.Pointer && v.Type().Elem().Kind() == reflect.Slice:
+		record = Record{Type: TypeArray, Value: records}
+	case len(records) == 0:
+		return fmt.Errorf("%s: empty response", method)
+	default:
+		return fmt.Errorf("%s: %d records in response, cannot scan them into %T", method, len(records), dest)
+	}
+
+	if err := record.Scan(dest); err != nil {
+		return fmt.Errorf("%s: cannot scan response into %T: %w", method, dest, err)
+	}
+
+	return nil
+}
+
+// Send writes a request for method with args to w, and returns without reading the response. Only the error of the
+// write is returned: a fault of the method is never seen.
+//
+// Kamailio still sends a response to each request. It stays unread on the connection, so a Call on the same
+// connection fails on the cookie of the skipped response: use a connection dedicated to Send, or read the responses
+// with ReadN before the next Call.
+func Send(w io.Writer, method string, args ...Record) error {
+	_, err := writeRequest(w, method, args)
+
+	return err
+}
+
+// writeRequest writes a request for method with args to w, and returns its cookie.
+func writeRequest(w io.Writer, method string, args []Record) (uint32, error) {
+	cookie := newCookie()
+
+	if err := writeRequestCookie(w, cookie, method, args); err != nil {
+		return 0, err
+	}
+
+	return cookie, nil
+}
+
+// writeRequestCookie writes a request for method with args and cookie to w.
+func writeRequestCookie(w io.Writer, cookie uint32, method string, args []Record) error {
+	records := make([]Record, 0, len(args)+1)
+	records = append(records, Record{Type: TypeString, Value: method})
+	records = append(records, args...)
+
+	return writePacket(w, cookie, PacketRequest, records)
+}
+
+// readResponse reads the response matching cookie from r. A fault response is returned as an *RPCError.
+func readResponse(r io.Reader, cookie uint32) ([]Record, error) {
+	_, records, err := decodeResponse(NewDecoder(r), cookie)
+
+	return records, err
+}
+
+// decodeResponse is like readResponse, reading with dec, and also returns the header of the response when it was read.
+func decodeResponse(dec *Decoder, cookie uint32) (*Header, []Record, error) {
+	header, records, err := dec.readPacket(cookie)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header.Flags == PacketFault {
+		return header, nil, newRPCError(records)
+	}
+
+	return header, records, nil
+}
+
+// newRPCError creates an RPCError from the records of a fault, an int code followed by a string message.
+func newRPCError(records []Record) *RPCError {
+	err := RPCError{}
+
+	if len(records) > 0 {
+		_ = records[0].Scan(&err.Code)
+	}
+	if len(records) > 1 {
+		_ = records[1].Scan(&err.Message)
+	}
+
+	return &err
+}
+
+// callEach calls method with args on rw, and calls fn with each record of the response as it is decoded, without
+// decoding the whole response first. The items of an array record are passed one by one. When fn returns an error,
+// callEach returns it after skipping the rest of the response, so the connection can be reused.
+func callEach(rw io.ReadWriter, method string, args []Record, fn func(record *Record) error) error {
+	if caller, ok := rw.(recordCaller); ok {
+		records, err := caller.callRecords(method, args)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range records {
+			if err := eachItem(&records[i], fn); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	cookie, err := writeRequest(rw, method, args)
+
+	if err != nil {
+		return err
+	}
+
+	dec := NewDecoder(rw)
+	header, err := dec.ReadHeader()
+
+	if err != nil {
+		return err
+	}
+
+	if header.Cookie != cookie {
+		return errors.New("expected cookie did not match")
+	}
+
+	if header.Flags == PacketFault {
+		records, err := dec.ReadPayload(header.PayloadLength)
+
+		if err != nil {
+			return err
+		}
+
+		return newRPCError(records)
+	}
+
+	payload := io.LimitReader(dec.r, int64(header.PayloadLength))
+	records := Decoder{r: payload, Strict: dec.Strict, Opaque: dec.Opaque}
+
+	for {
+		record, err := records.ReadRecord()
+
+		if err == io.EOF {
+			return nil
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: %w", ErrTruncated, err)
+		} else if err != nil {
+			return err
+		}
+
+		if err := eachItem(record, fn); err != nil {
+			_, _ = io.Copy(io.Discard, payload)
+			return err
+		}
+	}
+}
+
+// eachItem calls fn with record, or with each of its items if it is an array, and returns the first error of fn.
+func eachItem(record *Record, fn func(record *Record) error) error {
+	if record.Type != TypeArray {
+		return fn(record)
+	}
+
+	items, err := record.Array()
+
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		if err := fn(&items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,358 @@
+package binrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serve returns a connection to a fake Kamailio, answering each request with the packet type and records
+// returned by handler.
+func serve(t *testing.T, handler func(request []Record) (uint8, []Record)) net.Conn {
+	client, server := net.Pipe()
+
+	go func() {
+		defer server.Close()
+
+		// a single decoder, so that pipelined requests buffered with the first one are not lost
+		dec := NewDecoder(server)
+
+		for {
+			header, request, err := dec.readPacket(0)
+
+			if err != nil {
+				return
+			}
+
+			flags, records := handler(request)
+
+			if err := writePacket(server, header.Cookie, flags, records); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return client
+}
+
+// fault returns the records of a fault response.
+func fault(code int, message string) (uint8, []Record) {
+	return PacketFault, []Record{
+		{Type: TypeInt, Value: code},
+		{Type: TypeString, Value: message},
+	}
+}
+
+func TestCall(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, request[1:]
+	})
+
+	records, err := Call(conn, "core.echo", Record{Type: TypeString, Value: "bonjour"}, Record{Type: TypeInt, Value: 42})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if s, _ := records[0].String(); s != "bonjour" {
+		t.Errorf(`expected "bonjour", got "%s"`, s)
+	}
+	if i, _ := records[1].Int(); i != 42 {
+		t.Errorf("expected 42, got %d", i)
+	}
+}
+
+func TestCallFault(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return fault(500, "command core.bogus not found")
+	})
+
+	_, err := Call(conn, "core.bogus")
+
+	var rpcErr *RPCError
+
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected an RPCError, got %v", err)
+	}
+	if rpcErr.Code != 500 {
+		t.Errorf("expected code 500, got %d", rpcErr.Code)
+	}
+	if rpcErr.Message != "command core.bogus not found" {
+		t.Errorf("unexpected message %s", rpcErr.Message)
+	}
+}
+
+func TestFaultName(t *testing.T) {
+	for code, expected := range map[int]string{
+		FaultInvalidParameters: "invalid parameters",
+		FaultNotFound:          "not found",
+		FaultInternalError:     "internal error",
+		418:                    "unknown",
+	} {
+		if name := FaultName(code); name != expected {
+			t.Errorf("%d: expected %q, got %q", code, expected, name)
+		}
+	}
+
+	err := RPCError{Code: 400, Message: "error at parameter 1"}
+
+	if err.Error() != "rpc fault 400 (invalid parameters): error at parameter 1" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+}
+
+func TestCallConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < 32; i++ {
+		conn := serve(t, func(request []Record) (uint8, []Record) {
+			return PacketReply, request[1:]
+		})
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				records, err := Call(conn, "core.echo", NewInt(i*100+j))
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if records[0].Value != i*100+j {
+					t.Errorf("mismatched response %v for %d", records[0].Value, i*100+j)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestErrMethodNotFound(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "core.bogus" {
+			return fault(500, "command core.bogus not found")
+		}
+
+		return fault(500, "internal error")
+	})
+
+	_, err := Call(conn, "core.bogus")
+
+	var rpcErr *RPCError
+
+	if !errors.Is(err, ErrMethodNotFound) || !errors.As(err, &rpcErr) {
+		t.Errorf("expected ErrMethodNotFound in an *RPCError, got %v", err)
+	}
+
+	if _, err := Call(conn, "core.version"); errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected another fault, got %v", err)
+	}
+
+	notFound := &RPCError{Code: FaultNotFound, Message: "command core.bogus not found"}
+
+	if errors.Is(notFound, ErrMethodNotFound) {
+		t.Error("expected a 404 fault not to be ErrMethodNotFound")
+	}
+}
+
+func TestCallOne(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "core.bogus" {
+			return fault(500, "command core.bogus not found")
+		}
+
+		return PacketReply, request[1:]
+	})
+
+	record, err := CallOne(conn, "core.echo", NewString("bonjour"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := record.String(); s != "bonjour" {
+		t.Errorf(`expected "bonjour", got "%s"`, s)
+	}
+
+	if _, err := CallOne(conn, "core.echo"); err == nil || !strings.Contains(err.Error(), "empty response") {
+		t.Errorf("expected an error for an empty response, got %v", err)
+	}
+	if _, err := CallOne(conn, "core.echo", NewInt(1), NewInt(2)); err == nil || !strings.Contains(err.Error(), "2 records") {
+		t.Errorf("expected an error for 2 records, got %v", err)
+	}
+
+	var rpcErr *RPCError
+
+	if _, err := CallOne(conn, "core.bogus"); !errors.As(err, &rpcErr) {
+		t.Errorf("expected an *RPCError, got %v", err)
+	}
+}
+
+func TestCallScalar(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, request[1:]
+	})
+
+	if n, err := CallInt(conn, "core.echo", NewInt(42)); err != nil || n != 42 {
+		t.Errorf("expected 42, got %d, %v", n, err)
+	}
+	if s, err := CallString(conn, "core.echo", NewString("bonjour")); err != nil || s != "bonjour" {
+		t.Errorf(`expected "bonjour", got "%s", %v`, s, err)
+	}
+	if f, err := CallDouble(conn, "core.echo", NewDouble(1.5)); err != nil || f != 1.5 {
+		t.Errorf("expected 1.5, got %f, %v", f, err)
+	}
+
+	// type mismatch
+	if _, err := CallInt(conn, "core.echo", NewString("42")); err == nil || !strings.Contains(err.Error(), "type error") {
+		t.Errorf("expected a type error, got %v", err)
+	}
+	if _, err := CallString(conn, "core.echo", NewInt(42)); err == nil || !strings.Contains(err.Error(), "type error") {
+		t.Errorf("expected a type error, got %v", err)
+	}
+	if _, err := CallDouble(conn, "core.echo", Record{Type: TypeArray, Value: []Record{}}); err == nil ||
+		!strings.Contains(err.Error(), "type error") {
+		t.Errorf("expected a type error, got %v", err)
+	}
+
+	// several results
+	if _, err := CallInt(conn, "core.echo", NewInt(1), NewInt(2)); err == nil || !strings.Contains(err.Error(), "2 records") {
+		t.Errorf("expected an error for 2 records, got %v", err)
+	}
+	if _, err := CallString(conn, "core.echo"); err == nil || !strings.Contains(err.Error(), "empty response") {
+		t.Errorf("expected an error for an empty response, got %v", err)
+	}
+}
+
+func TestCallInto(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		switch method, _ := request[0].String(); method {
+		case "core.shmmem":
+			return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{
+				{Key: "total", Value: NewInt(1024)},
+				{Key: "free", Value: NewInt(512)},
+			}}}
+		case "core.echo":
+			return PacketReply, request[1:]
+		case "core.none":
+			return PacketReply, nil
+		}
+
+		return fault(500, "command not found")
+	})
+
+	var shmmem SHMMem
+
+	if err := CallInto(conn, &shmmem, "core.shmmem"); err != nil {
+		t.Fatal(err)
+	}
+	if shmmem.Total != 1024 || shmmem.Free != 512 {
+		t.Errorf("unexpected result %+v", shmmem)
+	}
+
+	// several records are scanned into a slice
+	var values []string
+
+	if err := CallInto(conn, &values, "core.echo", "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []string{"a", "2"}) {
+		t.Errorf("unexpected result %v", values)
+	}
+
+	var s string
+
+	if err := CallInto(conn, &s, "core.echo", "a", "b"); err == nil || !strings.Contains(err.Error(), "2 records") {
+		t.Errorf("expected an error for 2 records, got %v", err)
+	}
+	if err := CallInto(conn, &s, "core.none"); err == nil || !strings.Contains(err.Error(), "empty response") {
+		t.Errorf("expected an error for an empty response, got %v", err)
+	}
+	if err := CallInto(conn, &shmmem, "core.echo", "a"); err == nil || !strings.Contains(err.Error(), "*binrpc.SHMMem") {
+		t.Errorf("expected a scan error, got %v", err)
+	}
+	if err := CallInto(conn, &s, "core.echo", struct{}{}); err == nil {
+		t.Error("expected an error for an invalid argument")
+	}
+
+	var rpcErr *RPCError
+
+	if err := CallInto(conn, &s, "core.bogus"); !errors.As(err, &rpcErr) {
+		t.Errorf("expected an *RPCError, got %v", err)
+	}
+}
+
+func ExampleCall() {
+	// establish connection to Kamailio server
+	conn, err := net.Dial("tcp", "localhost:2049")
+
+	if err != nil {
+		panic(err)
+	}
+
+	records, err := Call(conn, "htable.seti",
+		Record{Type: TypeString, Value: "table"},
+		Record{Type: TypeString, Value: "key"},
+		Record{Type: TypeInt, Value: 42},
+	)
+
+	var rpcErr *RPCError
+
+	if errors.As(err, &rpcErr) {
+		fmt.Printf("fault %d: %s", rpcErr.Code, rpcErr.Message)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("records = %v", records)
+}
+
+func TestSend(t *testing.T) {
+	var buffer bytes.Buffer
+
+	for i := 0; i < 3; i++ {
+		if err := Send(&buffer, "cfg.reload", NewInt(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the requests are written one after the other, nothing is read
+	dec := NewDecoder(&buffer)
+
+	for i := 0; i < 3; i++ {
+		header, records, err := dec.readPacket(0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Flags != PacketRequest || header.Cookie == 0 {
+			t.Errorf("unexpected header %+v", header)
+		}
+		if method, _ := records[0].String(); method != "cfg.reload" {
+			t.Errorf("expected cfg.reload, got %s", method)
+		}
+		if n, _ := records[1].Int(); n != i {
+			t.Errorf("expected %d, got %d", i, n)
+		}
+	}
+
+	if err := Send(&buffer, "core.echo", NewString("a\x00b")); err == nil {
+		t.Error("expected an error for an invalid argument")
+	}
+}
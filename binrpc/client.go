@@ -0,0 +1,677 @@
+package binrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default values of the options of a Client.
+const (
+	DefaultTimeout   = 5 * time.Second
+	DefaultKeepAlive = 15 * time.Second
+	DefaultPoolSize  = 1
+)
+
+// Client calls RPC methods on a Kamailio instance, over connections that it dials and keeps open for the next calls.
+// A Client is safe for concurrent use: each call uses its own connection, taken from a pool of idle connections, and
+// writes its request then reads its response on it before releasing it. A connection is never used by two calls at
+// once, and the Client exposes none of them, so a response cannot be read by another call than the one that wrote the
+// request. The shared state of the Client, the pool and the pending calls, is synchronized.
+//
+// A BINRPC request has no field to name its caller, and Kamailio has no RPC method to label a connection: a request is
+// only a cookie, the method and its arguments, and the cookie is not logged by Kamailio. To correlate calls with the
+// logs of Kamailio, log them on the side of the caller WithLogger, by time and method.
+type Client struct {
+	network string
+	address string
+
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	keepAlive time.Duration
+	poolSize  int
+	logger    *slog.Logger
+	retries   int
+	aliases   Aliases
+	clock     Clock
+	bufSize   int
+
+	idleTimeout time.Duration
+	maxConns    int
+	transform   func(conn net.Conn) (io.ReadWriteCloser, error)
+
+	// random is the source of the cookies, read under randomMutex as an io.Reader may not be safe for concurrent use
+	random      io.Reader
+	randomMutex sync.Mutex
+
+	idle chan *Conn
+	// slots holds a value for each connection open, when their number is limited by maxConns
+	slots chan struct{}
+
+	mutex    sync.Mutex
+	lastCall uint64
+	pending  map[uint64]time.Time
+
+	// version is the protocol version of the first response, 0 before
+	version atomic.Uint32
+
+	middlewares []Middleware
+}
+
+// Clock is the source of time of a Client, for the timeout of dials and calls, the idle time of connections and the age
+// of pending calls. It defaults to the real time, and is meant for tests controlling time without sleeping, see
+// WithClock. TCP keep-alive probes are sent by the operating system, on the real time, and the retries of WithRetry
+// are immediate, without backoff to control.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by Clock.AfterFunc. Stop returns false if the timer already expired, like time.Timer.
+type Timer interface {
+	Stop() bool
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Option configures a Client created with New.
+type Option func(client *Client)
+
+// WithTimeout sets the timeout to dial a connection, and of a call when its context has no deadline.
+// It defaults to DefaultTimeout. Zero disables the timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(client *Client) {
+		client.timeout = timeout
+	}
+}
+
+// WithTLS makes the Client connect with TLS, for a ctl module listening behind a TLS proxy. It is not used by default.
+// New keeps a copy of config: changing config afterwards does not affect the connections dialed by the Client.
+func WithTLS(config *tls.Config) Option {
+	return func(client *Client) {
+		client.tlsConfig = config
+	}
+}
+
+// WithKeepAlive sets the period of the TCP keep-alive probes. It defaults to DefaultKeepAlive, a negative value
+// disables them.
+func WithKeepAlive(keepAlive time.Duration) Option {
+	return func(client *Client) {
+		client.keepAlive = keepAlive
+	}
+}
+
+// WithPoolSize sets the number of idle connections kept open for the next calls. It defaults to DefaultPoolSize.
+// More connections are dialed when calls are concurrent, up to WithMaxConns, and closed after use when the pool is full.
+func WithPoolSize(size int) Option {
+	return func(client *Client) {
+		client.poolSize = size
+	}
+}
+
+// WithLogger sets the logger of the Client, logging calls at the debug level and retries at the warn level.
+// Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(client *Client) {
+		client.logger = logger
+	}
+}
+
+// WithRetry makes the Client retry a call up to retries times on a new connection, when the call fails because of the
+// connection. A fault is never retried. It defaults to 0: as a request may have been executed before the connection
+// failed, only enable it for methods safe to repeat.
+func WithRetry(retries int) Option {
+	return func(client *Client) {
+		client.retries = retries
+	}
+}
+
+// WithAliases makes the Client resolve the names of legacy MI commands with aliases, like DefaultAliases.
+// Names are not resolved by default.
+func WithAliases(aliases Aliases) Option {
+	return func(client *Client) {
+		client.aliases = aliases
+	}
+}
+
+// WithClock replaces the real time used by the Client with clock. It is meant for tests.
+func WithClock(clock Clock) Option {
+	return func(client *Client) {
+		client.clock = clock
+	}
+}
+
+// WithBufferSize sets the size of the read buffer of a call. It defaults to DefaultBufferSize, see NewDecoderSize.
+func WithBufferSize(size int) Option {
+	return func(client *Client) {
+		client.bufSize = size
+	}
+}
+
+// WithIdleTimeout makes the Client close the idle connections of its pool not used for longer than timeout, instead of
+// reusing them, for a firewall or a NAT dropping idle connections. They are evicted when a call takes a connection
+// from the pool. Idle connections are never closed by default.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(client *Client) {
+		client.idleTimeout = timeout
+	}
+}
+
+// WithMaxConns limits the number of connections open at once to max. When they are all busy, a call waits for one of
+// them to be released, until its context is done: Call then returns ctx.Err(). The number of connections is not
+// limited by default, a connection is dialed for each concurrent call.
+func WithMaxConns(max int) Option {
+	return func(client *Client) {
+		client.maxConns = max
+	}
+}
+
+// WithTransform wraps each connection dialed by the Client with transform, like GzipTransform for a compressing proxy
+// in the path. The requests are written to and the responses read from the io.ReadWriteCloser it returns, closed with
+// the connection. Connections are not transformed by default.
+func WithTransform(transform func(conn net.Conn) (io.ReadWriteCloser, error)) Option {
+	return func(client *Client) {
+		client.transform = transform
+	}
+}
+
+// WithRandom sets the source of randomness of the cookies of the requests, crypto/rand.Reader by default. Each cookie
+// is 4 bytes read from random, as a big endian uint32, skipping zero. It is meant for tests, a deterministic source
+// making the cookies predictable: keep the default otherwise.
+func WithRandom(random io.Reader) Option {
+	return func(client *Client) {
+		client.random = random
+	}
+}
+
+// New returns a Client for the ctl module listening at addr, configured with opts. The Client keeps the address and
+// the dial options, so that the connections dialed later, like to replace a connection closed by Kamailio, are dialed
+// like the first one, with the same TLS configuration, timeout and keep-alive.
+//
+// The address uses the notation of the ctl module: "tcp:host:port", "udp:host:port" or "unix:/path/to/socket".
+// Without a prefix, like "localhost:2049", TCP is used. No connection is dialed until the first call.
+func New(addr string, opts ...Option) (*Client, error) {
+	network, address := parseAddress(addr)
+
+	if address == "" {
+		return nil, errors.New("invalid address: " + addr)
+	}
+
+	client := newClient(network, address, opts)
+
+	if client.poolSize < 0 {
+		return nil, errors.New("invalid pool size")
+	}
+	if client.retries < 0 {
+		return nil, errors.New("invalid number of retries")
+	}
+	if client.logger == nil {
+		return nil, errors.New("invalid logger")
+	}
+	if client.clock == nil {
+		return nil, errors.New("invalid clock")
+	}
+	if client.bufSize <= 0 {
+		return nil, errors.New("invalid buffer size")
+	}
+	if client.idleTimeout < 0 {
+		return nil, errors.New("invalid idle timeout")
+	}
+	if client.maxConns < 0 {
+		return nil, errors.New("invalid maximum number of connections")
+	}
+	if client.random == nil {
+		return nil, errors.New("invalid source of randomness")
+	}
+
+	// every connection is dialed with the same configuration, including those replacing a closed connection
+	client.tlsConfig = client.tlsConfig.Clone()
+	client.idle = make(chan *Conn, client.poolSize)
+
+	if client.maxConns > 0 {
+		client.slots = make(chan struct{}, client.maxConns)
+	}
+
+	return client, nil
+}
+
+// newClient returns a Client with the default options, configured with opts.
+func newClient(network, address string, opts []Option) *Client {
+	client := Client{
+		network:   network,
+		address:   address,
+		timeout:   DefaultTimeout,
+		keepAlive: DefaultKeepAlive,
+		poolSize:  DefaultPoolSize,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		clock:     realClock{},
+		bufSize:   DefaultBufferSize,
+		random:    rand.Reader,
+		pending:   map[uint64]time.Time{},
+	}
+
+	for _, opt := range opts {
+		opt(&client)
+	}
+
+	return &client
+}
+
+// DialContext connects to address on network (like "tcp"), with the options WithTimeout, WithTLS and WithKeepAlive.
+// The other options are ignored. The dial, including the TLS handshake, is aborted when ctx is cancelled or expires.
+func DialContext(ctx context.Context, network, address string, opts ...Option) (net.Conn, error) {
+	client := newClient(network, address, opts)
+
+	return client.dial(ctx)
+}
+
+// parseAddress splits addr in a network and an address for net.Dial.
+func parseAddress(addr string) (string, string) {
+	for _, network := range []string{"tcp", "udp", "unix"} {
+		if address, ok := strings.CutPrefix(addr, network+":"); ok {
+			return network, address
+		}
+	}
+
+	return "tcp", addr
+}
+
+// CallFunc is the signature of Client.Call, with args as a slice, called by a Middleware.
+type CallFunc func(ctx context.Context, method string, args []Record) ([]Record, error)
+
+// Middleware wraps the calls of a Client, for concerns like tracing, metrics or caching. It returns a CallFunc calling
+// next, or returning without calling it to short-circuit the call:
+//
+//	client.Use(func(next binrpc.CallFunc) binrpc.CallFunc {
+//		return func(ctx context.Context, method string, args []binrpc.Record) ([]binrpc.Record, error) {
+//			start := time.Now()
+//			records, err := next(ctx, method, args)
+//			latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+//
+//			return records, err
+//		}
+//	})
+type Middleware func(next CallFunc) CallFunc
+
+// Use adds middlewares to the calls of the Client. The first middleware added is the outermost: it is called first,
+// and returns last. Middlewares see the method after the resolution of WithAliases, and wrap the built-in retries and
+// logging of the Client, so they are called once per Call.
+func (client *Client) Use(mw ...Middleware) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.middlewares = append(client.middlewares[:len(client.middlewares):len(client.middlewares)], mw...)
+}
+
+// Call invokes method with args, and returns the records of the response. A fault response is returned as an *RPCError.
+//
+// The deadline of ctx covers the whole call: the wait for a connection of the pool when WithMaxConns limits them, the
+// dial, and the RPC itself, which gets the time left after the connection was acquired. If no time is left, Call
+// returns ctx.Err() without sending the request, and the connection goes back to the pool. If ctx has no deadline,
+// the RPC times out after the timeout of the Client, and the wait for a connection only ends with ctx.
+//
+// When ctx is cancelled, Call returns ctx.Err() right away, even while the response is being read. Each call has its
+// own connection: only the connection of the cancelled call is closed, other calls in progress are not affected.
+func (client *Client) Call(ctx context.Context, method string, args ...Record) ([]Record, error) {
+	var err error
+
+	if client.aliases != nil {
+		if method, err = client.aliases.Resolve(method); err != nil {
+			return nil, err
+		}
+	}
+
+	client.mutex.Lock()
+	middlewares := client.middlewares
+	client.mutex.Unlock()
+
+	call := client.invoke
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		call = middlewares[i](call)
+	}
+
+	return call(ctx, method, args)
+}
+
+// invoke calls method, retrying on a new connection when the connection fails.
+func (client *Client) invoke(ctx context.Context, method string, args []Record) ([]Record, error) {
+	var err error
+
+	id := client.begin()
+	defer client.end(id)
+
+	for attempt := 0; attempt <= client.retries; attempt++ {
+		if attempt > 0 {
+			client.logger.Warn("retrying rpc call", "method", method, "attempt", attempt, "error", err)
+		}
+
+		var records []Record
+
+		records, err = client.call(ctx, method, args)
+
+		var rpcErr *RPCError
+
+		if err == nil || errors.As(err, &rpcErr) || ctx.Err() != nil {
+			return records, err
+		}
+	}
+
+	return nil, err
+}
+
+// begin records the start of a call, and returns its id for end.
+func (client *Client) begin() uint64 {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.lastCall++
+	client.pending[client.lastCall] = client.clock.Now()
+
+	return client.lastCall
+}
+
+// end records the end of the call id.
+func (client *Client) end(id uint64) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	delete(client.pending, id)
+}
+
+// Pending returns the number of calls in progress, including their retries.
+func (client *Client) Pending() int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return len(client.pending)
+}
+
+// OldestPending returns for how long the oldest call in progress has been waiting, or 0 if no call is in progress.
+// Calls piling up with an increasing age show that Kamailio stopped responding.
+func (client *Client) OldestPending() time.Duration {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	var oldest time.Time
+
+	for _, start := range client.pending {
+		if oldest.IsZero() || start.Before(oldest) {
+			oldest = start
+		}
+	}
+
+	if oldest.IsZero() {
+		return 0
+	}
+
+	return client.clock.Now().Sub(oldest)
+}
+
+// call invokes method once, on an idle connection or a new one.
+func (client *Client) call(ctx context.Context, method string, args []Record) ([]Record, error) {
+	conn, err := client.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		// the wait for the connection used the deadline, the request is not sent and the connection is reusable
+		client.release(conn)
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// a cancelled context or the timeout unblocks the call by expiring the deadline of the connection
+	expire := func() {
+		conn.SetDeadline(time.Now())
+	}
+
+	stop := context.AfterFunc(ctx, expire)
+
+	// the deadline of ctx replaces the timeout
+	var timer Timer
+
+	if _, ok := ctx.Deadline(); !ok && client.timeout > 0 {
+		timer = client.clock.AfterFunc(client.timeout, expire)
+	}
+
+	client.logger.Debug("rpc call", "method", method, "address", client.address)
+
+	records, err := client.roundTrip(conn, method, args)
+
+	interrupted := !stop()
+
+	if timer != nil && !timer.Stop() {
+		interrupted = true
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// the call was interrupted by the context, the response may be partially read
+		conn.Close()
+		return nil, ctx.Err()
+	}
+
+	if interrupted {
+		// the deadline of the connection is expired, it cannot be reused
+		conn.Close()
+		return records, err
+	}
+
+	var rpcErr *RPCError
+
+	if err != nil && !errors.As(err, &rpcErr) {
+		// the response may be partially read, the connection cannot be reused
+		conn.Close()
+		return nil, err
+	}
+
+	client.release(conn)
+
+	return records, err
+}
+
+// roundTrip writes the request for method on conn, and reads the response to its end. A connection is only released
+// to the pool after roundTrip, or closed: the next request on a connection is never written before the previous
+// response is read entirely, so a large response cannot be interleaved with the next one.
+func (client *Client) roundTrip(conn net.Conn, method string, args []Record) ([]Record, error) {
+	cookie, err := client.newCookie()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeRequestCookie(conn, cookie, method, args); err != nil {
+		return nil, err
+	}
+
+	header, records, err := decodeResponse(NewDecoderSize(conn, client.bufSize), cookie)
+
+	if header != nil {
+		client.version.CompareAndSwap(0, uint32(header.Version))
+	}
+
+	return records, err
+}
+
+// newCookie returns a cookie read from the source of randomness of the Client. Zero is skipped, as it disables the
+// verification of the cookie.
+func (client *Client) newCookie() (uint32, error) {
+	client.randomMutex.Lock()
+	defer client.randomMutex.Unlock()
+
+	var buf [4]byte
+
+	for {
+		if _, err := io.ReadFull(client.random, buf[:]); err != nil {
+			return 0, fmt.Errorf("cannot generate cookie: %w", err)
+		}
+
+		if cookie := binary.BigEndian.Uint32(buf[:]); cookie != 0 {
+			return cookie, nil
+		}
+	}
+}
+
+// ProtocolVersion returns the version of the BINRPC protocol in the header of the first response read by the Client,
+// or 0 before the first response. Only BinRPCVersion is supported: a response with another version fails to decode,
+// and is not recorded.
+func (client *Client) ProtocolVersion() uint8 {
+	return uint8(client.version.Load())
+}
+
+// conn returns an idle connection, or dials a new one. When the number of connections is limited, it waits for an idle
+// connection or a free slot until ctx is done.
+func (client *Client) conn(ctx context.Context) (*Conn, error) {
+	client.evictIdle()
+
+	select {
+	case conn := <-client.idle:
+		return conn, nil
+	default:
+	}
+
+	if client.slots != nil {
+		select {
+		case conn := <-client.idle:
+			return conn, nil
+		case client.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	conn, err := client.dial(ctx)
+
+	if err != nil {
+		client.freeSlot()
+		return nil, err
+	}
+
+	if client.transform != nil {
+		rwc, err := client.transform(conn)
+
+		if err != nil {
+			conn.Close()
+			client.freeSlot()
+			return nil, err
+		}
+
+		conn = &transformedConn{Conn: conn, rwc: rwc}
+	}
+
+	wrapped := newConn(conn, client.clock)
+	wrapped.onClose = client.freeSlot
+
+	return wrapped, nil
+}
+
+// freeSlot frees the slot of a connection closed, or not dialed.
+func (client *Client) freeSlot() {
+	if client.slots != nil {
+		<-client.slots
+	}
+}
+
+// evictIdle closes the connections of the pool idle for longer than the idle timeout, and puts the others back.
+func (client *Client) evictIdle() {
+	if client.idleTimeout == 0 {
+		return
+	}
+
+	for i := len(client.idle); i > 0; i-- {
+		select {
+		case conn := <-client.idle:
+			if idle := conn.IdleTime(); idle > client.idleTimeout {
+				client.logger.Debug("closing idle connection", "address", client.address, "idle", idle)
+				conn.Close()
+			} else {
+				client.release(conn)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// dial connects to the address of the Client. The timeout is measured with the clock of the Client: it cancels the dial
+// like ctx, and is returned as a timeout error.
+func (client *Client) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{KeepAlive: client.keepAlive}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if client.timeout > 0 {
+		timer := client.clock.AfterFunc(client.timeout, func() {
+			cancel(os.ErrDeadlineExceeded)
+		})
+
+		defer timer.Stop()
+	}
+
+	var conn net.Conn
+	var err error
+
+	if client.tlsConfig != nil {
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: client.tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, client.network, client.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, client.network, client.address)
+	}
+
+	if err != nil && errors.Is(context.Cause(ctx), os.ErrDeadlineExceeded) {
+		return nil, &net.OpError{Op: "dial", Net: client.network, Err: os.ErrDeadlineExceeded}
+	}
+
+	return conn, err
+}
+
+// release puts conn back in the pool, or closes it if the pool is full.
+func (client *Client) release(conn *Conn) {
+	select {
+	case client.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// Close closes the idle connections of the Client. Calls in progress are not interrupted, and their connections are
+// closed when they complete if the pool is full.
+func (client *Client) Close() error {
+	var errs []error
+
+	for {
+		select {
+		case conn := <-client.idle:
+			errs = append(errs, conn.Close())
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
@@ -0,0 +1,1186 @@
+package binrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listen starts a fake Kamailio on a TCP port, answering each request with the packet type and records returned by
+// handler. It returns the address to connect to, and the number of connections accepted.
+func listen(t *testing.T, handler func(request []Record) (uint8, []Record)) (string, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return listener.Addr().String(), serveListener(t, listener, handler)
+}
+
+// serveListener answers the requests on the connections accepted by listener like listen, and returns the number of
+// connections accepted.
+func serveListener(t *testing.T, listener net.Listener, handler func(request []Record) (uint8, []Record)) *atomic.Int32 {
+	accepted := &atomic.Int32{}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			accepted.Add(1)
+
+			go func() {
+				defer conn.Close()
+
+				for {
+					header, request, err := readPacket(conn, 0)
+
+					if err != nil {
+						return
+					}
+
+					flags, records := handler(request)
+
+					if err := writePacket(conn, header.Cookie, flags, records); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	return accepted
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		address string
+	}{
+		{"localhost:2049", "tcp", "localhost:2049"},
+		{"tcp:localhost:2049", "tcp", "localhost:2049"},
+		{"udp:127.0.0.1:2049", "udp", "127.0.0.1:2049"},
+		{"unix:/run/kamailio/kamailio_ctl", "unix", "/run/kamailio/kamailio_ctl"},
+	}
+
+	for _, test := range tests {
+		network, address := parseAddress(test.addr)
+
+		if network != test.network || address != test.address {
+			t.Errorf("%s: expected %s %s, got %s %s", test.addr, test.network, test.address, network, address)
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	client, err := New("localhost:2049")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.timeout != DefaultTimeout || client.keepAlive != DefaultKeepAlive || client.poolSize != DefaultPoolSize {
+		t.Errorf("unexpected defaults %v %v %d", client.timeout, client.keepAlive, client.poolSize)
+	}
+	if client.retries != 0 || client.tlsConfig != nil || client.bufSize != DefaultBufferSize {
+		t.Errorf("unexpected defaults %d %v %d", client.retries, client.tlsConfig, client.bufSize)
+	}
+	if client.random != rand.Reader {
+		t.Error("expected crypto/rand.Reader as the source of the cookies")
+	}
+
+	if _, err := New("localhost:2049", WithPoolSize(-1)); err == nil {
+		t.Error("expected an error for a negative pool size")
+	}
+	if _, err := New(""); err == nil {
+		t.Error("expected an error for an empty address")
+	}
+}
+
+func TestClientRandom(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	cookies := make(chan uint32, 3)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			header, _, err := readPacket(conn, 0)
+
+			if err != nil {
+				return
+			}
+
+			cookies <- header.Cookie
+
+			if err := writePacket(conn, header.Cookie, PacketReply, nil); err != nil {
+				return
+			}
+		}
+	}()
+
+	// a zero cookie is skipped
+	random := bytes.NewReader([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xde, 0xad, 0xbe, 0xef})
+	client, err := New(listener.Addr().String(), WithRandom(random))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	for _, expected := range []uint32{0x00000001, 0xdeadbeef} {
+		if _, err := client.Call(context.Background(), "core.version"); err != nil {
+			t.Fatal(err)
+		}
+
+		if cookie := <-cookies; cookie != expected {
+			t.Errorf("expected cookie %08x, got %08x", expected, cookie)
+		}
+	}
+
+	// the source is exhausted
+	if _, err := client.Call(context.Background(), "core.version"); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	if _, err := New(listener.Addr().String(), WithRandom(nil)); err == nil {
+		t.Error("expected an error for a nil source")
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	addr, accepted := listen(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "core.bogus" {
+			return fault(500, "command core.bogus not found")
+		}
+
+		return PacketReply, request[1:]
+	})
+
+	client, err := New("tcp:"+addr, WithTimeout(time.Second), WithPoolSize(1), WithBufferSize(64*1024))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		records, err := client.Call(context.Background(), "core.echo", NewInt(i))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := records[0].Int(); n != i {
+			t.Errorf("expected %d, got %d", i, n)
+		}
+	}
+
+	var rpcErr *RPCError
+
+	if _, err := client.Call(context.Background(), "core.bogus"); !errors.As(err, &rpcErr) {
+		t.Errorf("expected an *RPCError, got %v", err)
+	}
+
+	// the idle connection is reused, even after a fault
+	if _, err := client.Call(context.Background(), "core.echo"); err != nil {
+		t.Error(err)
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	addr, accepted := listen(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{NewString("ok")}
+	})
+
+	client, err := New(addr, WithRetry(1))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	// put a broken connection in the pool, the call is retried on a new connection
+	broken, err := net.Dial("tcp", addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken.Close()
+	client.idle <- WrapConn(broken)
+
+	records, err := client.Call(context.Background(), "core.version")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := records[0].String(); s != "ok" {
+		t.Errorf(`expected "ok", got "%s"`, s)
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+}
+
+func TestClientCallContext(t *testing.T) {
+	addr, _ := listen(t, func(request []Record) (uint8, []Record) {
+		time.Sleep(time.Second)
+		return PacketReply, nil
+	})
+
+	client, err := New(addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.Call(ctx, "core.version"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+}
+
+// TestClientCallDeadline checks that the deadline of the context covers the wait for a connection and the RPC.
+func TestClientCallDeadline(t *testing.T) {
+	release := make(chan struct{})
+	requests := &atomic.Int32{}
+
+	addr, accepted := listen(t, func(request []Record) (uint8, []Record) {
+		requests.Add(1)
+
+		switch method, _ := request[0].String(); method {
+		case "core.block":
+			<-release
+		case "core.slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		return PacketReply, nil
+	})
+
+	client, err := New(addr, WithMaxConns(1), WithPoolSize(1))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	callTimeout := func(method string, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		_, err := client.Call(ctx, method)
+
+		return err
+	}
+
+	// the deadline expires while waiting for the only connection: the request is not sent
+	done := make(chan error)
+
+	go func() {
+		_, err := client.Call(context.Background(), "core.block")
+		done <- err
+	}()
+
+	for requests.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := callTimeout("core.version", 30*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+
+	// the deadline expires during the RPC
+	start := time.Now()
+
+	if err := callTimeout("core.slow", 30*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("expected the call to be interrupted, took %s", elapsed)
+	}
+
+	// no time is left once the idle connection is acquired: the request is not sent, the connection is reused
+	if _, err := client.Call(context.Background(), "core.version"); err != nil {
+		t.Fatal(err)
+	}
+
+	connections, sent := accepted.Load(), requests.Load()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.Call(ctx, "core.version"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+	if _, err := client.Call(context.Background(), "core.version"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != sent+1 {
+		t.Errorf("expected %d requests, got %d", sent+1, n)
+	}
+	if n := accepted.Load(); n != connections {
+		t.Errorf("expected the connection to be reused, got %d connections", n)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	// the listener accepts TCP connections, but never answers the TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = DialContext(ctx, "tcp", listener.Addr().String(), WithTLS(&tls.Config{}), WithTimeout(10*time.Second))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial was not cancelled, took %v", elapsed)
+	}
+
+	conn, err := DialContext(context.Background(), "tcp", listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Close()
+}
+
+func TestClientPending(t *testing.T) {
+	release := make(chan struct{})
+
+	addr, _ := listen(t, func(request []Record) (uint8, []Record) {
+		<-release
+		return PacketReply, nil
+	})
+
+	client, err := New(addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	if client.Pending() != 0 || client.OldestPending() != 0 {
+		t.Errorf("expected no pending call, got %d", client.Pending())
+	}
+
+	done := make(chan error)
+
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := client.Call(context.Background(), "core.version")
+			done <- err
+		}()
+	}
+
+	for client.Pending() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if age := client.OldestPending(); age < 10*time.Millisecond {
+		t.Errorf("expected the oldest call to wait at least 10ms, got %v", age)
+	}
+
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if client.Pending() != 0 {
+		t.Errorf("expected no pending call, got %d", client.Pending())
+	}
+}
+
+// fakeClock is a Clock advanced by tests.
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	expires time.Time
+	f       func()
+	done    bool
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	timer := &fakeTimer{clock: clock, expires: clock.now.Add(d), f: f}
+	clock.timers = append(clock.timers, timer)
+
+	return timer
+}
+
+// Advance moves the clock forward by d, and runs the functions of the timers expiring.
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+
+	clock.now = clock.now.Add(d)
+	expired := []func(){}
+
+	for _, timer := range clock.timers {
+		if !timer.done && !timer.expires.After(clock.now) {
+			timer.done = true
+			expired = append(expired, timer.f)
+		}
+	}
+
+	clock.mutex.Unlock()
+
+	for _, f := range expired {
+		f()
+	}
+}
+
+// Waiting returns the number of timers not expired or stopped.
+func (clock *fakeClock) Waiting() int {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	n := 0
+
+	for _, timer := range clock.timers {
+		if !timer.done {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (timer *fakeTimer) Stop() bool {
+	timer.clock.mutex.Lock()
+	defer timer.clock.mutex.Unlock()
+
+	stopped := !timer.done
+	timer.done = true
+
+	return stopped
+}
+
+func TestClientClock(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	addr, _ := listen(t, func(request []Record) (uint8, []Record) {
+		<-release
+		return PacketReply, nil
+	})
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client, err := New(addr, WithClock(clock), WithTimeout(3*time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	done := make(chan error)
+
+	go func() {
+		_, err := client.Call(context.Background(), "core.version")
+		done <- err
+	}()
+
+	for clock.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(2 * time.Second)
+
+	if age := client.OldestPending(); age != 2*time.Second {
+		t.Errorf("expected the call to wait for 2s, got %v", age)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected the call to wait for the timeout, got %v", err)
+	default:
+	}
+
+	// the timeout expires without waiting for 3 real seconds
+	clock.Advance(time.Second)
+
+	var netErr net.Error
+
+	if err := <-done; !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestClientCallCancel(t *testing.T) {
+	release := make(chan struct{})
+
+	addr, _ := listen(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "core.slow" {
+			<-release
+		}
+
+		return PacketReply, request[:1]
+	})
+
+	client, err := New(addr, WithPoolSize(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+
+	go func() {
+		_, err := client.Call(ctx, "core.slow")
+		cancelled <- err
+	}()
+
+	slow := make(chan error)
+
+	go func() {
+		_, err := client.Call(context.Background(), "core.slow")
+		slow <- err
+	}()
+
+	for client.Pending() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// the other calls are not affected
+	records, err := client.Call(context.Background(), "core.fast")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method, _ := records[0].String(); method != "core.fast" {
+		t.Errorf("expected core.fast, got %s", method)
+	}
+
+	close(release)
+
+	if err := <-slow; err != nil {
+		t.Errorf("expected the slow call to complete, got %v", err)
+	}
+}
+
+func TestClientIdleTimeout(t *testing.T) {
+	addr, accepted := listen(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{NewString("ok")}
+	})
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client, err := New(addr, WithClock(clock), WithIdleTimeout(time.Minute), WithPoolSize(2))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	dial := func() *Conn {
+		conn, err := net.Dial("tcp", addr)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return newConn(conn, clock)
+	}
+
+	// stale is idle for 2 minutes, fresh for 30 seconds
+	stale := dial()
+	clock.Advance(90 * time.Second)
+	fresh := dial()
+	clock.Advance(30 * time.Second)
+
+	if idle := stale.IdleTime(); idle != 2*time.Minute {
+		t.Errorf("expected an idle time of 2m, got %v", idle)
+	}
+
+	client.idle <- stale
+	client.idle <- fresh
+
+	if _, err := client.Call(context.Background(), "core.version"); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the stale connection is closed, the call used the fresh one
+	if _, err := stale.Conn.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected the stale connection to be closed, got %v", err)
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+	if len(client.idle) != 1 || fresh.IdleTime() != 0 || !fresh.LastUse().Equal(clock.Now()) {
+		t.Errorf("expected the fresh connection to be used and back in the pool")
+	}
+}
+
+func TestClientMaxConns(t *testing.T) {
+	release := make(chan struct{})
+
+	addr, accepted := listen(t, func(request []Record) (uint8, []Record) {
+		<-release
+		return PacketReply, nil
+	})
+
+	client, err := New(addr, WithMaxConns(2), WithPoolSize(2))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	done := make(chan error)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := client.Call(context.Background(), "core.version")
+			done <- err
+		}()
+	}
+
+	for client.Pending() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the pool is exhausted, the getters with a short deadline give up
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			if _, err := client.Call(ctx, "core.version"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected a deadline error, got %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// the other getters are served when the connections are released
+	close(release)
+
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+	if n := len(client.slots); n != 2 {
+		t.Errorf("expected 2 slots used by the idle connections, got %d", n)
+	}
+
+	client.Close()
+
+	if n := len(client.slots); n != 0 {
+		t.Errorf("expected the slots to be freed, got %d", n)
+	}
+}
+
+// TestClientConcurrent hammers a shared Client, to be run with -race.
+func TestClientConcurrent(t *testing.T) {
+	addr, _ := listen(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, request[1:]
+	})
+
+	client, err := New("tcp:"+addr, WithTimeout(5*time.Second), WithPoolSize(2), WithMaxConns(4))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				arg := fmt.Sprintf("call %d.%d", i, j)
+
+				records, err := client.Call(context.Background(), "core.echo", NewString(arg))
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				// each call reads its own response
+				if s, _ := records[0].String(); s != arg {
+					t.Errorf("expected %q, got %q", arg, s)
+					return
+				}
+
+				client.Pending()
+				client.OldestPending()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := client.Pending(); n != 0 {
+		t.Errorf("expected no pending call, got %d", n)
+	}
+}
+
+// listenTLS is like listen with TLS, and returns the configuration of a client trusting its certificate, and the
+// number of TLS handshakes.
+func listenTLS(t *testing.T, handler func(request []Record) (uint8, []Record)) (string, *tls.Config, *atomic.Int32) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kamailio"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshakes := &atomic.Int32{}
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			handshakes.Add(1)
+			return nil, nil
+		},
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serveListener(t, listener, handler)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	return listener.Addr().String(), &tls.Config{RootCAs: roots}, handshakes
+}
+
+func TestClientReconnectTLS(t *testing.T) {
+	addr, config, handshakes := listenTLS(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{NewString("ok")}
+	})
+
+	client, err := New("tcp:"+addr, WithTLS(config), WithTimeout(5*time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	// changing the configuration after New does not affect the Client
+	config.RootCAs = nil
+
+	if _, err := client.Call(context.Background(), "core.version"); err != nil {
+		t.Fatal(err)
+	}
+
+	// force the close of the pooled connection, the next call dials a new one
+	conn := <-client.idle
+
+	if _, ok := conn.Conn.(*tls.Conn); !ok {
+		t.Fatalf("expected a TLS connection, got %T", conn.Conn)
+	}
+
+	conn.Close()
+
+	records, err := client.Call(context.Background(), "core.version")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := records[0].String(); s != "ok" {
+		t.Errorf(`expected "ok", got "%s"`, s)
+	}
+
+	conn = <-client.idle
+
+	if tlsConn, ok := conn.Conn.(*tls.Conn); !ok || !tlsConn.ConnectionState().HandshakeComplete {
+		t.Errorf("expected a TLS connection after the reconnect, got %T", conn.Conn)
+	}
+
+	conn.Close()
+
+	if n := handshakes.Load(); n != 2 {
+		t.Errorf("expected 2 TLS handshakes, got %d", n)
+	}
+}
+
+func TestClientProtocolVersion(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// the first response advertises version 2, the next ones version 1
+	versions := []byte{2, 1, 1}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				for {
+					header, _, err := readPacket(conn, 0)
+
+					if err != nil || len(versions) == 0 {
+						return
+					}
+
+					var buffer bytes.Buffer
+
+					_ = writePacket(&buffer, header.Cookie, PacketReply, []Record{NewString("ok")})
+
+					response := buffer.Bytes()
+					response[0] = BinRPCMagic<<4 | versions[0]
+					versions = versions[1:]
+
+					if _, err := conn.Write(response); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	client, err := New(listener.Addr().String(), WithTimeout(5*time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	if v := client.ProtocolVersion(); v != 0 {
+		t.Errorf("expected 0 before the first call, got %d", v)
+	}
+
+	if _, err := client.Call(context.Background(), "core.version"); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("expected a version error, got %v", err)
+	}
+	if v := client.ProtocolVersion(); v != 0 {
+		t.Errorf("expected 0 after an unsupported version, got %d", v)
+	}
+
+	if _, err := client.Call(context.Background(), "core.version"); err != nil {
+		t.Fatal(err)
+	}
+	if v := client.ProtocolVersion(); v != BinRPCVersion {
+		t.Errorf("expected %d, got %d", BinRPCVersion, v)
+	}
+}
+
+func TestClientUse(t *testing.T) {
+	addr, _ := listen(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, request[1:]
+	})
+
+	client, err := New("tcp:"+addr, WithTimeout(5*time.Second), WithAliases(Aliases{"echo": "core.echo"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	var calls []string
+
+	trace := func(name string) Middleware {
+		return func(next CallFunc) CallFunc {
+			return func(ctx context.Context, method string, args []Record) ([]Record, error) {
+				calls = append(calls, name+" "+method)
+				records, err := next(ctx, method, args)
+				calls = append(calls, name+" done")
+
+				return records, err
+			}
+		}
+	}
+
+	// a cache short-circuiting the calls of the next middlewares and of the Client
+	cache := map[string][]Record{}
+
+	caching := func(next CallFunc) CallFunc {
+		return func(ctx context.Context, method string, args []Record) ([]Record, error) {
+			if records, ok := cache[method]; ok {
+				return records, nil
+			}
+
+			records, err := next(ctx, method, args)
+
+			if err == nil {
+				cache[method] = records
+			}
+
+			return records, err
+		}
+	}
+
+	client.Use(trace("outer"), caching)
+	client.Use(trace("inner"))
+
+	for i := 0; i < 2; i++ {
+		records, err := client.Call(context.Background(), "echo", NewString("cached"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := records[0].String(); s != "cached" {
+			t.Errorf(`expected "cached", got "%s"`, s)
+		}
+	}
+
+	expected := []string{
+		"outer core.echo", "inner core.echo", "inner done", "outer done",
+		// the second call is returned by the cache
+		"outer core.echo", "outer done",
+	}
+
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestClientLargeResponses(t *testing.T) {
+	addr, accepted := listen(t, func(request []Record) (uint8, []Record) {
+		n, _ := request[1].Int()
+		items := make([]Record, 0, 4096)
+
+		for i := 0; i < 4096; i++ {
+			items = append(items, NewString(fmt.Sprintf("%d.%d.%s", n, i, strings.Repeat("x", 64))))
+		}
+
+		return PacketReply, []Record{{Type: TypeArray, Value: items}}
+	})
+
+	client, err := New("tcp:"+addr, WithTimeout(5*time.Second), WithPoolSize(1), WithMaxConns(1))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	// responses of about 300KB back to back on the same connection, much larger than the read buffer
+	for n := 0; n < 10; n++ {
+		records, err := client.Call(context.Background(), "core.dump", NewInt(n))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items, err := records[0].Array()
+
+		if err != nil || len(items) != 4096 {
+			t.Fatalf("call %d: expected 4096 items, got %d %v", n, len(items), err)
+		}
+
+		for i, item := range items {
+			if s, _ := item.String(); !strings.HasPrefix(s, fmt.Sprintf("%d.%d.", n, i)) {
+				t.Fatalf("call %d: unexpected item %d %q", n, i, s)
+			}
+		}
+	}
+
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+}
+
+func TestClientClockDial(t *testing.T) {
+	// the TLS handshake never completes
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	done := make(chan error)
+
+	go func() {
+		_, err := DialContext(context.Background(), "tcp", listener.Addr().String(), WithClock(clock),
+			WithTimeout(3*time.Second), WithTLS(&tls.Config{InsecureSkipVerify: true}))
+		done <- err
+	}()
+
+	for clock.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the timeout of the dial expires without waiting for 3 real seconds
+	clock.Advance(3 * time.Second)
+
+	var netErr net.Error
+
+	if err := <-done; !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
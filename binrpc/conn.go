@@ -0,0 +1,72 @@
+package binrpc
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Conn is a net.Conn recording when it was last used, by its reads and writes. The pool of a Client uses it to evict
+// the connections idle for longer than WithIdleTimeout, before a firewall or a NAT silently drops them.
+type Conn struct {
+	net.Conn
+
+	clock   Clock
+	created time.Time
+	// lastUse is the time of the last read or write, since created. Both are read from clock, so the duration is
+	// monotonic with the real clock.
+	lastUse atomic.Int64
+
+	// onClose is called once when the connection is closed, to free its slot in the pool.
+	onClose   func()
+	closeOnce sync.Once
+}
+
+// WrapConn returns conn recording its last use, starting now.
+func WrapConn(conn net.Conn) *Conn {
+	return newConn(conn, realClock{})
+}
+
+// newConn is like WrapConn, with the time of clock.
+func newConn(conn net.Conn, clock Clock) *Conn {
+	return &Conn{Conn: conn, clock: clock, created: clock.Now()}
+}
+
+func (conn *Conn) Read(p []byte) (int, error) {
+	defer conn.touch()
+
+	return conn.Conn.Read(p)
+}
+
+func (conn *Conn) Write(p []byte) (int, error) {
+	defer conn.touch()
+
+	return conn.Conn.Write(p)
+}
+
+// Close closes the connection.
+func (conn *Conn) Close() error {
+	err := conn.Conn.Close()
+
+	if conn.onClose != nil {
+		conn.closeOnce.Do(conn.onClose)
+	}
+
+	return err
+}
+
+// LastUse returns the time of the last read or write, or of the creation of the Conn if it was not used yet.
+func (conn *Conn) LastUse() time.Time {
+	return conn.created.Add(time.Duration(conn.lastUse.Load()))
+}
+
+// IdleTime returns for how long the connection has not been used.
+func (conn *Conn) IdleTime() time.Duration {
+	return conn.clock.Now().Sub(conn.created) - time.Duration(conn.lastUse.Load())
+}
+
+// touch records a use of the connection now.
+func (conn *Conn) touch() {
+	conn.lastUse.Store(int64(conn.clock.Now().Sub(conn.created)))
+}
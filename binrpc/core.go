@@ -0,0 +1,316 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SHMMem is the shared memory usage returned by "core.shmmem", in bytes.
+type SHMMem struct {
+	Total     int `binrpc:"total"`
+	Free      int `binrpc:"free"`
+	Used      int `binrpc:"used"`
+	RealUsed  int `binrpc:"real_used"`
+	MaxUsed   int `binrpc:"max_used"`
+	Fragments int `binrpc:"fragments"`
+}
+
+// TCPInfo is the state of the TCP connections returned by "core.tcp_info".
+type TCPInfo struct {
+	Readers              int `binrpc:"readers"`
+	MaxConnections       int `binrpc:"max_connections"`
+	MaxTLSConnections    int `binrpc:"max_tls_connections"`
+	OpenedConnections    int `binrpc:"opened_connections"`
+	OpenedTLSConnections int `binrpc:"opened_tls_connections"`
+	WriteQueuedBytes     int `binrpc:"write_queued_bytes"`
+}
+
+// CoreSHMMem calls "core.shmmem" and returns the shared memory usage.
+func CoreSHMMem(conn io.ReadWriter) (SHMMem, error) {
+	shmmem := SHMMem{}
+	err := callStruct(conn, &shmmem, "core.shmmem")
+
+	return shmmem, err
+}
+
+// CoreTCPInfo calls "core.tcp_info" and returns the state of the TCP connections.
+func CoreTCPInfo(conn io.ReadWriter) (TCPInfo, error) {
+	info := TCPInfo{}
+	err := callStruct(conn, &info, "core.tcp_info")
+
+	return info, err
+}
+
+// Version is a version of Kamailio, like "5.7.4" in "kamailio 5.7.4 (x86_64/linux) 0f9a3f".
+// Suffix is the pre-release part of the version, like "dev3" in "5.8.0-dev3".
+type Version struct {
+	Full   string
+	Major  int
+	Minor  int
+	Patch  int
+	Suffix string
+}
+
+// versionPattern matches "5.7.4", "5.8.0-dev3" or "4.4" anywhere in a version string.
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?(?:[-~]([0-9A-Za-z.]+))?`)
+
+// ParseVersion parses the version numbers of s, a version string like "kamailio 5.7.4 (x86_64/linux) 0f9a3f" returned
+// by "core.version", or just "5.7.4". A missing patch number is 0.
+func ParseVersion(s string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(s)
+
+	if match == nil {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	version := Version{Full: s, Suffix: match[4]}
+	version.Major, _ = strconv.Atoi(match[1])
+	version.Minor, _ = strconv.Atoi(match[2])
+
+	if match[3] != "" {
+		version.Patch, _ = strconv.Atoi(match[3])
+	}
+
+	return version, nil
+}
+
+// AtLeast reports whether the version is major.minor or later, to use features or response shapes that depend on the
+// version of Kamailio.
+func (version Version) AtLeast(major, minor int) bool {
+	if version.Major != major {
+		return version.Major > major
+	}
+
+	return version.Minor >= minor
+}
+
+// String returns the version numbers, like "5.7.4" or "5.8.0-dev3".
+func (version Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+
+	if version.Suffix != "" {
+		s += "-" + version.Suffix
+	}
+
+	return s
+}
+
+// ServerInfo calls "core.version" and returns the parsed version of Kamailio.
+func ServerInfo(conn io.ReadWriter) (Version, error) {
+	var full string
+
+	if err := callStruct(conn, &full, "core.version"); err != nil {
+		return Version{}, err
+	}
+
+	return ParseVersion(full)
+}
+
+// GetDebugLevel returns the debug level of Kamailio, the "debug" variable of the "core" group of the cfg framework.
+// It calls "cfg.get" of the cfg_rpc module: the error matches ErrMethodNotFound if the module is not loaded.
+func GetDebugLevel(conn io.ReadWriter) (int, error) {
+	var level int
+
+	if err := callStruct(conn, &level, "cfg.get", NewString("core"), NewString("debug")); err != nil {
+		return 0, debugLevelError(err)
+	}
+
+	return level, nil
+}
+
+// SetDebugLevel sets the debug level of Kamailio with "cfg.seti" of the cfg_rpc module, like GetDebugLevel. The level
+// applies to all the processes at once, and is not saved: restore the level returned by GetDebugLevel after use.
+func SetDebugLevel(conn io.ReadWriter, level int) error {
+	_, err := Call(conn, "cfg.seti", NewString("core"), NewString("debug"), NewInt(level))
+
+	return debugLevelError(err)
+}
+
+// debugLevelError explains the error of a method of the cfg_rpc module not found.
+func debugLevelError(err error) error {
+	if errors.Is(err, ErrMethodNotFound) {
+		return fmt.Errorf("debug level not available, the cfg_rpc module is not loaded: %w", err)
+	}
+
+	return err
+}
+
+// Proto is the transport protocol of a socket or an alias, in lower case like "udp". Other values returned by
+// Kamailio, like a protocol added by a module, are kept as is.
+type Proto string
+
+// Protocols of the sockets and aliases of Kamailio. ProtoAny is the protocol of an alias valid for all of them.
+const (
+	ProtoUDP  Proto = "udp"
+	ProtoTCP  Proto = "tcp"
+	ProtoTLS  Proto = "tls"
+	ProtoSCTP Proto = "sctp"
+	ProtoWS   Proto = "ws"
+	ProtoWSS  Proto = "wss"
+	ProtoAny  Proto = "*"
+)
+
+// Known reports whether proto is one of the protocols of the constants.
+func (proto Proto) Known() bool {
+	switch proto {
+	case ProtoUDP, ProtoTCP, ProtoTLS, ProtoSCTP, ProtoWS, ProtoWSS, ProtoAny:
+		return true
+	}
+
+	return false
+}
+
+// Socket is a socket Kamailio listens on, returned by "core.sockets_list".
+//
+// Addresses has a single address, or one per address of a multi-homed SCTP socket. When the socket is listening on a
+// host name, IPAddress is its IP address. The advertised address and port are empty when not set with "advertise".
+type Socket struct {
+	Proto            Proto    `binrpc:"proto"`
+	Addresses        []string `binrpc:"address"`
+	IPAddress        string   `binrpc:"ipaddress"`
+	Port             int      `binrpc:"port"`
+	Multicast        bool     `binrpc:"mcast"`
+	MultiHomed       bool     `binrpc:"mhomed"`
+	Name             string   `binrpc:"sockname"`
+	AdvertiseAddress string   `binrpc:"advertise_address"`
+	AdvertisePort    int      `binrpc:"advertise_port"`
+}
+
+// Alias is a host name Kamailio recognizes as itself, returned by "core.aliases_list". Port is 0 for any port.
+type Alias struct {
+	Proto   Proto  `binrpc:"proto"`
+	Address string `binrpc:"address"`
+	Port    int    `binrpc:"port"`
+}
+
+// CoreSockets returns the sockets Kamailio listens on. It calls "core.sockets_list", or "corex.list_sockets" of the
+// corex module on the versions of Kamailio without it.
+func CoreSockets(conn io.ReadWriter) ([]Socket, error) {
+	var sockets struct {
+		Sockets []Socket `binrpc:"socket"`
+	}
+
+	err := callStruct(conn, &sockets, "core.sockets_list")
+
+	if errors.Is(err, ErrMethodNotFound) {
+		err = callStruct(conn, &sockets, "corex.list_sockets")
+	}
+
+	return sockets.Sockets, err
+}
+
+// CoreAliases calls "core.aliases_list" and returns the aliases of Kamailio.
+func CoreAliases(conn io.ReadWriter) ([]Alias, error) {
+	var aliases struct {
+		Aliases []Record `binrpc:"aliases"`
+	}
+
+	if err := callStruct(conn, &aliases, "core.aliases_list"); err != nil {
+		return nil, err
+	}
+
+	result := make([]Alias, 0, len(aliases.Aliases))
+
+	for i, record := range aliases.Aliases {
+		// depending on the version, each alias is wrapped in a struct with an "alias" key
+		if items, err := record.StructItems(); err == nil && len(items) == 1 && items[0].Key == "alias" {
+			record = items[0].Value
+		}
+
+		var alias Alias
+
+		if err := record.Scan(&alias); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+
+		result = append(result, alias)
+	}
+
+	return result, nil
+}
+
+// CorePPID calls "core.ppid" and returns the process id of the main process of Kamailio.
+func CorePPID(conn io.ReadWriter) (int, error) {
+	var ppid int
+
+	err := callStruct(conn, &ppid, "core.ppid")
+
+	return ppid, err
+}
+
+// ErrDocNotAvailable is returned by MethodDoc when Kamailio has no documentation for a method.
+var ErrDocNotAvailable = errors.New("documentation not available")
+
+// ListMethods calls "system.listMethods" and returns the names of the RPC methods of Kamailio, including those of the
+// modules loaded.
+func ListMethods(conn io.ReadWriter) ([]string, error) {
+	records, err := Call(conn, "system.listMethods")
+
+	if err != nil {
+		return nil, err
+	}
+
+	methods := []string{}
+
+	for _, record := range records {
+		// the methods are top level records, or an array
+		items := []Record{record}
+
+		if record.Type == TypeArray {
+			items, _ = record.Array()
+		}
+
+		for _, item := range items {
+			method, err := item.String()
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid method: %w", err)
+			}
+
+			methods = append(methods, method)
+		}
+	}
+
+	return methods, nil
+}
+
+// MethodDoc calls "system.methodHelp" and returns the documentation of method, the text shown by "kamcmd help". The
+// error matches ErrDocNotAvailable when the method has no documentation, does not exist, or when Kamailio does not
+// document its methods.
+func MethodDoc(conn io.ReadWriter, method string) (string, error) {
+	doc, err := CallString(conn, "system.methodHelp", NewString(method))
+
+	var rpcErr *RPCError
+
+	if errors.As(err, &rpcErr) {
+		return "", fmt.Errorf("%w for %s: %w", ErrDocNotAvailable, method, err)
+	} else if err != nil {
+		return "", err
+	}
+
+	// Kamailio replies "undocumented" for a method registered without documentation
+	if doc = strings.TrimSpace(doc); doc == "" || doc == "undocumented" {
+		return "", fmt.Errorf("%w for %s", ErrDocNotAvailable, method)
+	}
+
+	return doc, nil
+}
+
+// callStruct calls method with args, and scans the first record of the response into dest.
+func callStruct(conn io.ReadWriter, dest any, method string, args ...Record) error {
+	records, err := Call(conn, method, args...)
+
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return errors.New("empty response")
+	}
+
+	return records[0].Scan(dest)
+}
@@ -0,0 +1,344 @@
+package binrpc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoreSHMMem(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{
+			{Type: TypeStruct, Value: []StructItem{
+				{Key: "total", Value: Record{Type: TypeInt, Value: 33554432}},
+				{Key: "free", Value: Record{Type: TypeInt, Value: 30000000}},
+				{Key: "used", Value: Record{Type: TypeInt, Value: 2000000}},
+				{Key: "real_used", Value: Record{Type: TypeInt, Value: 3554432}},
+				{Key: "max_used", Value: Record{Type: TypeInt, Value: 3600000}},
+				{Key: "fragments", Value: Record{Type: TypeInt, Value: 80}},
+			}},
+		}
+	})
+
+	shmmem, err := CoreSHMMem(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := SHMMem{Total: 33554432, Free: 30000000, Used: 2000000, RealUsed: 3554432, MaxUsed: 3600000, Fragments: 80}
+
+	if shmmem != expected {
+		t.Errorf("expected %+v, got %+v", expected, shmmem)
+	}
+}
+
+func TestCoreTCPInfo(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{
+			{Type: TypeStruct, Value: []StructItem{
+				{Key: "readers", Value: Record{Type: TypeInt, Value: 8}},
+				{Key: "max_connections", Value: Record{Type: TypeInt, Value: 4096}},
+				{Key: "max_tls_connections", Value: Record{Type: TypeInt, Value: 2048}},
+				{Key: "opened_connections", Value: Record{Type: TypeInt, Value: 12}},
+				{Key: "opened_tls_connections", Value: Record{Type: TypeInt, Value: 3}},
+				{Key: "write_queued_bytes", Value: Record{Type: TypeInt, Value: 0}},
+			}},
+		}
+	})
+
+	info, err := CoreTCPInfo(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := TCPInfo{Readers: 8, MaxConnections: 4096, MaxTLSConnections: 2048, OpenedConnections: 12, OpenedTLSConnections: 3}
+
+	if info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestCoreSHMMemEmpty(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, nil
+	})
+
+	if _, err := CoreSHMMem(conn); err == nil {
+		t.Error("expected an error for an empty response")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{"kamailio 5.7.4 (x86_64/linux) 0f9a3f", "5.7.4"},
+		{"kamailio 5.8.0-dev3 (x86_64/linux) a8d6e2", "5.8.0-dev3"},
+		{"kamailio 4.4.7 (x86_64/linux)", "4.4.7"},
+		{"kamailio 6.0.1 (aarch64/linux) 5b2c07-dirty", "6.0.1"},
+		{"kamailio 3.1 (i386/linux)", "3.1.0"},
+		{"5.6.1", "5.6.1"},
+	}
+
+	for _, test := range tests {
+		version, err := ParseVersion(test.s)
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if version.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.s, test.expected, version)
+		}
+		if version.Full != test.s {
+			t.Errorf("expected %s, got %s", test.s, version.Full)
+		}
+	}
+
+	if _, err := ParseVersion("kamailio (x86_64/linux)"); err == nil {
+		t.Error("expected an error without version numbers")
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	version := Version{Major: 5, Minor: 7, Patch: 4}
+
+	for _, test := range []struct {
+		major, minor int
+		expected     bool
+	}{
+		{5, 7, true},
+		{5, 6, true},
+		{4, 9, true},
+		{5, 8, false},
+		{6, 0, false},
+	} {
+		if version.AtLeast(test.major, test.minor) != test.expected {
+			t.Errorf("%d.%d: expected %v", test.major, test.minor, test.expected)
+		}
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{NewString("kamailio 5.7.4 (x86_64/linux) 0f9a3f")}
+	})
+
+	version, err := ServerInfo(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version.Major != 5 || version.Minor != 7 || version.Patch != 4 || !version.AtLeast(5, 5) {
+		t.Errorf("unexpected version %+v", version)
+	}
+}
+
+func TestDebugLevel(t *testing.T) {
+	level := 2
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+
+		switch method {
+		case "cfg.get":
+			return PacketReply, []Record{NewInt(level)}
+		case "cfg.seti":
+			level, _ = request[3].Int()
+			return PacketReply, nil
+		}
+
+		return fault(500, "command "+method+" not found")
+	})
+
+	if err := SetDebugLevel(conn, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := GetDebugLevel(conn); err != nil || n != 3 {
+		t.Errorf("expected 3, got %d %v", n, err)
+	}
+
+	// without the cfg_rpc module
+	conn = serve(t, func(request []Record) (uint8, []Record) {
+		return fault(500, "command cfg.get not found")
+	})
+
+	if _, err := GetDebugLevel(conn); !errors.Is(err, ErrMethodNotFound) || !strings.Contains(err.Error(), "cfg_rpc") {
+		t.Errorf("expected ErrMethodNotFound, got %v", err)
+	}
+}
+
+func TestCoreSockets(t *testing.T) {
+	socket := func(items ...StructItem) StructItem {
+		return StructItem{Key: "socket", Value: Record{Type: TypeStruct, Value: items}}
+	}
+
+	response := Record{Type: TypeStruct, Value: []StructItem{
+		socket(
+			StructItem{Key: "proto", Value: NewString("udp")},
+			StructItem{Key: "address", Value: NewString("10.0.0.1")},
+			StructItem{Key: "port", Value: NewString("5060")},
+			StructItem{Key: "mcast", Value: NewString("no")},
+			StructItem{Key: "mhomed", Value: NewString("no")},
+			StructItem{Key: "advertise_address", Value: NewString("203.0.113.1")},
+			StructItem{Key: "advertise_port", Value: NewInt(5060)},
+		),
+		socket(
+			StructItem{Key: "proto", Value: NewString("sctp")},
+			StructItem{Key: "address", Value: NewString("10.0.0.1")},
+			StructItem{Key: "address", Value: NewString("10.0.1.1")},
+			StructItem{Key: "port", Value: NewString("5060")},
+			StructItem{Key: "mcast", Value: NewString("no")},
+			StructItem{Key: "mhomed", Value: NewString("yes")},
+		),
+	}}
+
+	var methods []string
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+		methods = append(methods, method)
+
+		if method == "corex.list_sockets" {
+			return PacketReply, []Record{response}
+		}
+
+		return fault(500, "command "+method+" not found")
+	})
+
+	sockets, err := CoreSockets(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(methods) != 2 || methods[0] != "core.sockets_list" {
+		t.Errorf("expected a fallback to corex.list_sockets, got %v", methods)
+	}
+
+	if len(sockets) != 2 {
+		t.Fatalf("expected 2 sockets, got %+v", sockets)
+	}
+
+	udp := sockets[0]
+
+	if udp.Proto != ProtoUDP || !udp.Proto.Known() || len(udp.Addresses) != 1 || udp.Port != 5060 || udp.Multicast ||
+		udp.AdvertiseAddress != "203.0.113.1" || udp.AdvertisePort != 5060 {
+		t.Errorf("unexpected socket %+v", udp)
+	}
+
+	sctp := sockets[1]
+
+	if sctp.Proto != ProtoSCTP || len(sctp.Addresses) != 2 || sctp.Addresses[1] != "10.0.1.1" || !sctp.MultiHomed {
+		t.Errorf("unexpected socket %+v", sctp)
+	}
+}
+
+func TestCoreAliases(t *testing.T) {
+	alias := func(proto, address string, port int) Record {
+		return Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "proto", Value: NewString(proto)},
+			{Key: "address", Value: NewString(address)},
+			{Key: "port", Value: NewInt(port)},
+		}}
+	}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{
+			{Key: "myself_callbacks", Value: NewString("no")},
+			{Key: "aliases", Value: Record{Type: TypeArray, Value: []Record{
+				alias("*", "sip.example.com", 0),
+				{Type: TypeStruct, Value: []StructItem{{Key: "alias", Value: alias("tls", "example.com", 5061)}}},
+			}}},
+		}}}
+	})
+
+	aliases, err := CoreAliases(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Alias{
+		{Proto: ProtoAny, Address: "sip.example.com"},
+		{Proto: ProtoTLS, Address: "example.com", Port: 5061},
+	}
+
+	if !reflect.DeepEqual(aliases, expected) {
+		t.Errorf("expected %+v, got %+v", expected, aliases)
+	}
+
+	if Proto("quic").Known() {
+		t.Error("expected quic to be unknown")
+	}
+}
+
+func TestCorePPID(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{NewInt(1234)}
+	})
+
+	if ppid, err := CorePPID(conn); err != nil || ppid != 1234 {
+		t.Errorf("expected 1234, got %d %v", ppid, err)
+	}
+}
+
+func TestMethodDoc(t *testing.T) {
+	docs := map[string]string{
+		"core.ppid":    "Returns the PID of the main process.",
+		"core.bogus":   "",
+		"htable.flush": "undocumented",
+	}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		switch method, _ := request[0].String(); method {
+		case "system.listMethods":
+			return PacketReply, []Record{NewString("core.ppid"), NewString("htable.flush")}
+		case "system.methodHelp":
+			name, _ := request[1].String()
+
+			if doc, ok := docs[name]; ok && doc != "" {
+				return PacketReply, []Record{NewString(doc)}
+			}
+
+			return fault(FaultInvalidParameters, "command not found")
+		}
+
+		return fault(500, "command not found")
+	})
+
+	methods, err := ListMethods(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(methods, []string{"core.ppid", "htable.flush"}) {
+		t.Errorf("unexpected methods %v", methods)
+	}
+
+	if doc, err := MethodDoc(conn, "core.ppid"); err != nil || doc != docs["core.ppid"] {
+		t.Errorf("expected %q, got %q %v", docs["core.ppid"], doc, err)
+	}
+
+	for _, method := range []string{"core.bogus", "htable.flush"} {
+		if _, err := MethodDoc(conn, method); !errors.Is(err, ErrDocNotAvailable) {
+			t.Errorf("%s: expected ErrDocNotAvailable, got %v", method, err)
+		}
+	}
+
+	// without system.methodHelp
+	conn = serve(t, func(request []Record) (uint8, []Record) {
+		return fault(500, "command system.methodHelp not found")
+	})
+
+	if _, err := MethodDoc(conn, "core.ppid"); !errors.Is(err, ErrDocNotAvailable) || !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected ErrDocNotAvailable and ErrMethodNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package binrpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dump returns a human readable representation of records, one record per line, with the items of structs and arrays
+// indented below them:
+//
+//	struct {
+//	  total: int 33554432
+//	  used: int 2000000
+//	}
+func Dump(records []Record) string {
+	var builder strings.Builder
+
+	for _, record := range records {
+		dumpRecord(&builder, record, 0)
+		builder.WriteByte('\n')
+	}
+
+	return builder.String()
+}
+
+func dumpRecord(builder *strings.Builder, record Record, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	switch value := record.withItems().Value.(type) {
+	case []StructItem:
+		builder.WriteString("struct {\n")
+
+		for _, item := range value {
+			builder.WriteString(indent + "  " + item.Key + ": ")
+			dumpRecord(builder, item.Value, depth+1)
+			builder.WriteByte('\n')
+		}
+
+		builder.WriteString(indent + "}")
+	case []Record:
+		builder.WriteString("array [\n")
+
+		for _, item := range value {
+			builder.WriteString(indent + "  ")
+			dumpRecord(builder, item, depth+1)
+			builder.WriteByte('\n')
+		}
+
+		builder.WriteString(indent + "]")
+	case string:
+		fmt.Fprintf(builder, "%s %q", TypeName(record.Type), value)
+	default:
+		fmt.Fprintf(builder, "%s %v", TypeName(record.Type), value)
+	}
+}
+
+// CallDebug is like Call, but also returns a pretty printed transcript of the exchange: the raw bytes and the Dump of
+// the request and of the response. It is meant for interactive tools and tests, Call should be used otherwise.
+func CallDebug(conn io.ReadWriter, method string, args ...Record) ([]Record, string, error) {
+	capture := captureConn{rw: conn}
+	records, err := Call(&capture, method, args...)
+
+	var transcript strings.Builder
+
+	transcript.WriteString("> " + hex.EncodeToString(capture.written.Bytes()) + "\n")
+	transcript.WriteString(dumpPacket(capture.written.Bytes()))
+	transcript.WriteString("< " + hex.EncodeToString(capture.read.Bytes()) + "\n")
+	transcript.WriteString(dumpPacket(capture.read.Bytes()))
+
+	return records, transcript.String(), err
+}
+
+// dumpPacket decodes a captured packet and returns its Dump, or the decoding error.
+func dumpPacket(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	header, records, err := readPacket(bytes.NewReader(data), 0)
+
+	if err != nil {
+		return fmt.Sprintf("error: %v\n", err)
+	}
+
+	return fmt.Sprintf("%s cookie=%x\n%s", packetKind(header.Flags), header.Cookie, Dump(records))
+}
+
+// packetKind returns the name of the packet type flags.
+func packetKind(flags uint8) string {
+	switch flags {
+	case PacketReply:
+		return "reply"
+	case PacketFault:
+		return "fault"
+	}
+
+	return "request"
+}
+
+// AnnotateHex returns an annotated hex dump of data, a raw BINRPC packet, for bug reports: a line for the header and
+// for each record, with its offset, its bytes and its decoded value, indented in structs and arrays. Each key of a
+// struct is a record of type avp before its value, like on the wire:
+//
+//	0000  a1 10 0e 01                                      reply cookie=1 length=14
+//	0004  03                                               struct {
+//	0005  65 74 6f 74 61 6c 00                               avp "total"
+//	000c  40 02 00 00 00                                     int 33554432
+//	0011  83                                               }
+//
+// The bytes of a record longer than 16 bytes are truncated. If data cannot be decoded, AnnotateHex returns the dump
+// up to the invalid record, and an error with its offset.
+func AnnotateHex(data []byte) (string, error) {
+	reader := bytes.NewReader(data)
+	dec := Decoder{r: reader}
+
+	header, err := dec.ReadHeader()
+
+	if err != nil {
+		return "", err
+	}
+
+	annotator := hexAnnotator{data: data}
+	offset := len(data) - reader.Len()
+
+	annotator.line(0, data[:offset], 0, fmt.Sprintf("%s cookie=%x length=%d", packetKind(header.Flags), header.Cookie,
+		header.PayloadLength))
+
+	end := offset + header.PayloadLength
+
+	if end > len(data) {
+		return annotator.String(), fmt.Errorf("%w: payload length %d, got %d bytes", ErrTruncated,
+			header.PayloadLength, len(data)-offset)
+	}
+
+	annotator.data = data[:end]
+
+	for offset < end {
+		if offset, err = annotator.record(offset, 0); err != nil {
+			return annotator.String(), err
+		}
+	}
+
+	if end < len(data) {
+		return annotator.String(), fmt.Errorf("%d bytes after the packet", len(data)-end)
+	}
+
+	return annotator.String(), nil
+}
+
+// annotatedBytes is the number of bytes of a record dumped by AnnotateHex.
+const annotatedBytes = 16
+
+// hexAnnotator writes the lines of AnnotateHex.
+type hexAnnotator struct {
+	strings.Builder
+
+	data []byte
+}
+
+// line writes the line of the bytes at offset.
+func (annotator *hexAnnotator) line(offset int, data []byte, depth int, text string) {
+	dump := make([]string, 0, annotatedBytes)
+
+	for i, b := range data {
+		if i == annotatedBytes {
+			dump = append(dump, "..")
+			break
+		}
+
+		dump = append(dump, fmt.Sprintf("%02x", b))
+	}
+
+	fmt.Fprintf(annotator, "%04x  %-*s %s%s\n", offset, 3*annotatedBytes, strings.Join(dump, " "),
+		strings.Repeat("  ", depth), text)
+}
+
+// record annotates the record at offset, with the records it contains, and returns the offset of the next one.
+func (annotator *hexAnnotator) record(offset, depth int) (int, error) {
+	data := annotator.data[offset:]
+	typ, _, long, sizeLen := ParseHeader(data[0])
+
+	if long && sizeLen == 0 && (typ == TypeStruct || typ == TypeArray) {
+		return 0, fmt.Errorf("offset %d: unexpected end of %s", offset, TypeName(typ))
+	}
+
+	if typ != TypeStruct && typ != TypeArray {
+		dec := Decoder{r: bytes.NewReader(data)}
+		record, err := dec.ReadRecord()
+
+		if err != nil {
+			if err = unexpectedEOF(err); errors.Is(err, io.ErrUnexpectedEOF) {
+				err = fmt.Errorf("%w: %w", ErrTruncated, err)
+			}
+
+			return 0, fmt.Errorf("offset %d: %w", offset, err)
+		}
+
+		var value strings.Builder
+
+		dumpRecord(&value, *record, 0)
+		annotator.line(offset, data[:record.size], depth, value.String())
+
+		return offset + record.size, nil
+	}
+
+	open, end := "struct {", "}"
+
+	if typ == TypeArray {
+		open, end = "array [", "]"
+	}
+
+	annotator.line(offset, data[:1], depth, open)
+	offset++
+
+	for {
+		if offset >= len(annotator.data) {
+			return 0, fmt.Errorf("offset %d: %w: %s not terminated", offset, ErrTruncated, TypeName(typ))
+		}
+
+		if endTyp, _, long, sizeLen := ParseHeader(annotator.data[offset]); long && sizeLen == 0 && endTyp == typ {
+			annotator.line(offset, annotator.data[offset:offset+1], depth, end)
+
+			return offset + 1, nil
+		}
+
+		var err error
+
+		if offset, err = annotator.record(offset, depth+1); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// captureConn keeps a copy of the bytes written to and read from rw.
+type captureConn struct {
+	rw      io.ReadWriter
+	written bytes.Buffer
+	read    bytes.Buffer
+}
+
+func (conn *captureConn) Write(p []byte) (int, error) {
+	n, err := conn.rw.Write(p)
+	conn.written.Write(p[:n])
+
+	return n, err
+}
+
+func (conn *captureConn) Read(p []byte) (int, error) {
+	n, err := conn.rw.Read(p)
+	conn.read.Write(p[:n])
+
+	return n, err
+}
@@ -0,0 +1,123 @@
+package binrpc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	records := []Record{
+		NewInt(200),
+		{Type: TypeStruct, Value: []StructItem{
+			{Key: "name", Value: NewString("main")},
+			{Key: "loads", Value: Record{Type: TypeArray, Value: []Record{NewDouble(0.5), NewInt(1)}}},
+		}},
+	}
+
+	expected := `int 200
+struct {
+  name: string "main"
+  loads: array [
+    double 0.5
+    int 1
+  ]
+}
+`
+
+	if dump := Dump(records); dump != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, dump)
+	}
+}
+
+func TestCallDebug(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, request[1:]
+	})
+
+	records, transcript, err := CallDebug(conn, "core.echo", NewString("bonjour"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+
+	for _, expected := range []string{"> a1", "request cookie=", `string "core.echo"`, "< a1", "reply cookie=", `string "bonjour"`} {
+		if !strings.Contains(transcript, expected) {
+			t.Errorf("transcript does not contain %q:\n%s", expected, transcript)
+		}
+	}
+}
+
+func TestCallDebugFault(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return fault(500, "command core.bogus not found")
+	})
+
+	_, transcript, err := CallDebug(conn, "core.bogus")
+
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if !strings.Contains(transcript, "fault cookie=") || !strings.Contains(transcript, "int 500") {
+		t.Errorf("unexpected transcript:\n%s", transcript)
+	}
+}
+
+func TestAnnotateHex(t *testing.T) {
+	var buffer bytes.Buffer
+
+	err := writePacket(&buffer, 0x1234, PacketReply, []Record{
+		{Type: TypeStruct, Value: []StructItem{
+			{Key: "uri", Value: NewString("sip:10.0.0.1:5060;transport=tcp")},
+			{Key: "flags", Value: Record{Type: TypeArray, Value: []Record{NewInt(1), NewDouble(-1.5)}}},
+		}},
+		NewInt(7),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotated, err := AnnotateHex(buffer.Bytes())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"0000  a1 11 3b 12 34                                   reply cookie=1234 length=59",
+		"0005  03                                               struct {",
+		"0006  45 75 72 69 00                                     avp \"uri\"",
+		"000b  91 20 73 69 70 3a 31 30 2e 30 2e 30 2e 31 3a 35 ..   string \"sip:10.0.0.1:5060;transport=tcp\"",
+		"002d  65 66 6c 61 67 73 00                               avp \"flags\"",
+		"0034  04                                                 array [",
+		"0035  10 01                                                int 1",
+		"0037  42 ff ff fa 24                                       double -1.5",
+		"003c  84                                                 ]",
+		"003d  83                                               }",
+		"003e  10 07                                            int 7",
+	}
+
+	if lines := strings.Split(strings.TrimSuffix(annotated, "\n"), "\n"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), annotated)
+	}
+
+	// truncated in the middle of the array
+	data := buffer.Bytes()[:0x37]
+
+	data[2] = 0x37 - 5
+
+	annotated, err = AnnotateHex(data)
+
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+	if !strings.Contains(annotated, "avp \"flags\"") {
+		t.Errorf("expected the records before the error, got\n%s", annotated)
+	}
+}
@@ -0,0 +1,529 @@
+package binrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Decoder reads BINRPC packets from an input stream.
+//
+// By default the Decoder is lenient and decodes what it can, like Kamailio does. When Strict is set, it also validates
+// the invariants of the protocol and returns an error on any deviation:
+//
+// - the packet type in the header is known
+//
+// - the size bits of a struct or array start marker (reserved) are zero
+//
+// - the length of a size is between 1 and 4 bytes, and ints and doubles are at most 4 bytes
+//
+// - strings are terminated by a null byte
+//
+// - records use exactly the payload length announced in the header
+//
+// This is useful to detect a misbehaving peer or a bug in this package.
+//
+// A record of a type not implemented, like TypeBytes or a type added by a later version of Kamailio, returns an error.
+// When Opaque is set, and Strict is not, it is decoded instead as a Record of its type code holding its raw value as an
+// OpaqueValue, so that the other records of the response can be used, and the record skipped or passed through.
+//
+// A Decoder reads successive packets from a stream, whatever their type, until io.EOF between two packets. It can be used
+// to consume packets pushed on a dedicated connection. Note that the evapi module does not use BINRPC: its messages are
+// raw text or netstrings, and cannot be read by a Decoder.
+//
+// A Decoder is not safe for concurrent use. It can be reused with Reset to keep its buffers, like one Decoder per
+// connection in a pool.
+type Decoder struct {
+	r        io.Reader
+	buffered *bufio.Reader
+	payload  []byte
+	scratch  [8]byte
+
+	Strict bool
+	Opaque bool
+}
+
+// OpaqueValue is the raw value of a record of a type not implemented, decoded by a Decoder with Opaque set. The Type of
+// the Record is the type code read. Encode writes it back as is.
+type OpaqueValue []byte
+
+// DefaultBufferSize is the size of the read buffer of a Decoder created by NewDecoder.
+const DefaultBufferSize = 4096
+
+// NewDecoder returns a new Decoder reading from r. The Decoder introduces its own buffering.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderSize(r, DefaultBufferSize)
+}
+
+// NewDecoderSize is like NewDecoder with a read buffer of size bytes. A larger buffer reduces the number of reads of
+// many small records. The payload of a packet larger than the buffer is read directly, whatever its size.
+func NewDecoderSize(r io.Reader, size int) *Decoder {
+	dec := Decoder{buffered: bufio.NewReaderSize(r, size)}
+	dec.Reset(r)
+
+	return &dec
+}
+
+// Reset discards any buffered data, and makes the Decoder read from r. The buffers of the Decoder are kept, so
+// decoding from many readers does not allocate them again.
+func (dec *Decoder) Reset(r io.Reader) {
+	if dec.buffered == nil {
+		dec.buffered = bufio.NewReaderSize(r, DefaultBufferSize)
+	} else {
+		dec.buffered.Reset(r)
+	}
+
+	dec.r = dec.buffered
+}
+
+// ReadHeader reads and returns the Header of the next packet.
+func (dec *Decoder) ReadHeader() (*Header, error) {
+	buf := make([]byte, 2)
+
+	if _, err := io.ReadFull(dec.r, buf); err == io.EOF {
+		// nothing was read, the stream ended cleanly between two packets
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	if magic := buf[0] >> 4; magic != BinRPCMagic {
+		if isText(buf) {
+			return nil, fmt.Errorf("%w: response starts with %q, the address may be a FIFO or another text interface "+
+				"instead of the binrpc socket of the ctl module", ErrTextResponse, buf)
+		}
+
+		return nil, fmt.Errorf("magic field did not match, expected %X, got %X", BinRPCMagic, magic)
+	}
+
+	version := buf[0] & 0x0F
+
+	if version != BinRPCVersion {
+		return nil, fmt.Errorf("version did not match, expected %d, got %d", BinRPCVersion, version)
+	}
+
+	flags := buf[1] >> 4
+	sizeOfLength := buf[1]&0x0C>>2 + 1
+	sizeOfCookie := buf[1]&0x3 + 1
+
+	if dec.Strict && flags != PacketRequest && flags != PacketReply && flags != PacketFault {
+		return nil, fmt.Errorf("strict: unknown packet type %d", flags)
+	}
+
+	buf = make([]byte, sizeOfLength)
+
+	if err := dec.readFull(buf); err != nil {
+		return nil, fmt.Errorf("cannot read total length: %w", err)
+	}
+
+	header := Header{
+		Flags:   flags,
+		Version: version,
+	}
+
+	// the length is on up to 4 bytes, it does not fit in an int on 32-bit platforms above math.MaxInt32
+	var length uint32
+
+	for _, b := range buf {
+		length = length<<8 | uint32(b)
+	}
+
+	if uint64(length) > math.MaxInt {
+		return nil, fmt.Errorf("payload length too big: %d bytes", length)
+	}
+
+	header.PayloadLength = int(length)
+
+	cookieBytes := make([]byte, sizeOfCookie)
+
+	if err := dec.readFull(cookieBytes); err != nil {
+		return nil, fmt.Errorf("cannot read cookie: %w", err)
+	}
+
+	for _, b := range cookieBytes {
+		header.Cookie = header.Cookie<<8 | uint32(b)
+	}
+
+	return &header, nil
+}
+
+// ReadRecord reads and returns the next Record.
+// It returns io.EOF if the input ended before the record, and a wrapped io.ErrUnexpectedEOF if it ended in the middle.
+func (dec *Decoder) ReadRecord() (*Record, error) {
+	record := Record{}
+
+	// the header, the size and small values are read in the scratch buffer, they are decoded before the next read
+	buf := dec.scratch[:1]
+
+	if _, err := io.ReadFull(dec.r, buf); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read record header: %w", err)
+	}
+
+	typ, size, long, sizeLen := ParseHeader(buf[0])
+
+	record.size = 1 + sizeLen + size
+	record.Type = typ
+
+	if long && sizeLen == 0 && record.Type == TypeStruct {
+		// this marks the end of a struct
+		return nil, errEndOfStruct
+	}
+
+	if long && sizeLen == 0 && record.Type == TypeArray {
+		// this marks the end of an array
+		return nil, errEndOfArray
+	}
+
+	if dec.Strict {
+		if long && (sizeLen == 0 || sizeLen > 4) {
+			return nil, fmt.Errorf("strict: invalid length of size %d for type %s (%d)", sizeLen, TypeName(record.Type), record.Type)
+		}
+		if !long && size != 0 && (record.Type == TypeStruct || record.Type == TypeArray) {
+			return nil, fmt.Errorf("strict: reserved bits set in start marker of type %s (%d)", TypeName(record.Type), record.Type)
+		}
+	}
+
+	if long {
+		// the size is at most 7 bytes, read at the end of the scratch buffer to decode it as a uint64
+		clear(dec.scratch[:])
+		buf = dec.scratch[len(dec.scratch)-sizeLen:]
+
+		if err := dec.readFull(buf); err != nil {
+			return nil, fmt.Errorf("cannot read record size: %w", err)
+		}
+
+		n := binary.BigEndian.Uint64(dec.scratch[:])
+
+		if n > math.MaxInt32 {
+			// a record cannot be larger than its packet, limited to 2GB so that sizes fit in an int on any platform
+			return nil, fmt.Errorf("invalid record size %d", n)
+		}
+
+		size = int(n)
+		record.size += size
+	}
+
+	if dec.Strict {
+		switch record.Type {
+		case TypeInt, TypeDouble:
+			if size > 4 {
+				return nil, fmt.Errorf("strict: invalid size %d for type %s (%d)", size, TypeName(record.Type), record.Type)
+			}
+		}
+	}
+
+	if size == 0 {
+		buf = nil
+	} else if size <= len(dec.scratch) && (record.Type == TypeInt || record.Type == TypeDouble) {
+		buf = dec.scratch[:size]
+
+		if err := dec.readFull(buf); err != nil {
+			return nil, fmt.Errorf("cannot read record value: %w", err)
+		}
+	} else {
+		var err error
+
+		if buf, err = dec.readBytes(size); err != nil {
+			return nil, fmt.Errorf("cannot read record value: %w", err)
+		}
+	}
+
+	switch record.Type {
+	case TypeAVP:
+		fallthrough
+	case TypeString:
+		if dec.Strict && (size == 0 || buf[size-1] != 0x00) {
+			return nil, errors.New("strict: string is not null terminated")
+		}
+
+		if size == 0 {
+			record.Value = ""
+			break
+		}
+
+		// skip the null byte
+		record.Value = string(buf[0 : len(buf)-1])
+	case TypeInt:
+		record.Value = decodeInt(buf)
+	case TypeDouble:
+		// double are implemented as int*1000
+		record.Value = float64(decodeInt(buf)) / 1000.0
+	case TypeStruct:
+		// an empty struct has empty items, not nil
+		items := []StructItem{}
+
+		for {
+			avpName, err := dec.readNestedRecord()
+
+			if err == errEndOfStruct {
+				record.size++
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			if avpName.Type != TypeAVP {
+				return nil, fmt.Errorf("struct contains something else than avp: %d", avpName.Type)
+			}
+
+			record.size += avpName.size
+
+			avpValue, err := dec.readNestedRecord()
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, StructItem{
+				Key:   avpName.Value.(string),
+				Value: *avpValue,
+			})
+
+			record.size += avpValue.size
+		}
+
+		record.Value = items
+	case TypeArray:
+		items := []Record{}
+
+		for {
+			item, err := dec.readNestedRecord()
+
+			if err == errEndOfArray {
+				record.size++
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			items = append(items, *item)
+
+			record.size += item.size
+		}
+
+		record.Value = items
+	default:
+		if !dec.Opaque || dec.Strict {
+			return nil, fmt.Errorf("type error: type %s (%d) not implemented", TypeName(record.Type), record.Type)
+		}
+
+		// buf was allocated for this value, it is not reused
+		record.Value = OpaqueValue(buf)
+	}
+
+	return &record, nil
+}
+
+// ParseHeader decodes the first byte of a record, its header, without reading the value. typ is the type of the
+// record, in the low 4 bits. The high bit selects the form of the size, in the 3 bits left: in the short form, they
+// are shortSize, the size of the value; in the long form, they are sizeLen, the number of bytes of the big endian size
+// following the header, and shortSize is 0. A struct or an array ends with a header in the long form with a sizeLen of 0.
+func ParseHeader(b byte) (typ uint8, shortSize int, longForm bool, sizeLen int) {
+	typ = b & 0x0F
+	size := int(b >> 4 & 0x7)
+
+	if b>>7 == 1 {
+		return typ, 0, true, size
+	}
+
+	return typ, size, false, 0
+}
+
+// DecodePacket decodes the packet in data, and returns its header and records. It returns an error if data is not
+// exactly one packet.
+func DecodePacket(data []byte) (*Header, []Record, error) {
+	reader := bytes.NewReader(data)
+	dec := Decoder{r: reader}
+
+	header, err := dec.ReadHeader()
+
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("cannot read header: %w", io.ErrUnexpectedEOF)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if header.PayloadLength > reader.Len() {
+		return nil, nil, fmt.Errorf("cannot read payload: %w", io.ErrUnexpectedEOF)
+	}
+
+	records, err := dec.ReadPayload(header.PayloadLength)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if reader.Len() != 0 {
+		return nil, nil, fmt.Errorf("%d bytes after the packet", reader.Len())
+	}
+
+	return header, records, nil
+}
+
+// ReadPacket reads the next packet and returns its records.
+// If expectedCookie is not zero, it verifies the cookie.
+func (dec *Decoder) ReadPacket(expectedCookie uint32) ([]Record, error) {
+	_, records, err := dec.readPacket(expectedCookie)
+
+	return records, err
+}
+
+// readPacket is like ReadPacket but also returns the header, needed to detect faults.
+func (dec *Decoder) readPacket(expectedCookie uint32) (*Header, []Record, error) {
+	header, err := dec.ReadHeader()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if expectedCookie != 0 && expectedCookie != header.Cookie {
+		return nil, nil, errors.New("expected cookie did not match")
+	}
+
+	records, err := dec.ReadPayload(header.PayloadLength)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, records, nil
+}
+
+// ReadPayload reads extactly payloadLength bytes and returns records, or an error if one occurred.
+func (dec *Decoder) ReadPayload(payloadLength int) ([]Record, error) {
+	var payloadBytes []byte
+
+	// the payload buffer is reused, values are copied out of it by ReadRecord
+	if cap(dec.payload) >= payloadLength {
+		payloadBytes = dec.payload[:payloadLength]
+
+		if err := dec.readFull(payloadBytes); err != nil {
+			return nil, fmt.Errorf("cannot read payload: %w", err)
+		}
+	} else {
+		var err error
+
+		if payloadBytes, err = dec.readBytes(payloadLength); err != nil {
+			return nil, fmt.Errorf("cannot read payload: %w", err)
+		}
+
+		dec.payload = payloadBytes
+	}
+
+	var err error
+
+	read := 0
+	payload := &Decoder{
+		r:      bytes.NewReader(payloadBytes),
+		Strict: dec.Strict,
+		Opaque: dec.Opaque,
+	}
+	records := []Record{}
+
+	for read < payloadLength {
+		record, err := payload.readNestedRecord()
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// the whole payload was read, so the records are longer than the payload
+			return nil, fmt.Errorf("%w: %w", ErrTruncated, err)
+		} else if err != nil {
+			return nil, err
+		}
+
+		records = append(records, *record)
+		read += record.size
+	}
+
+	if dec.Strict && read != payloadLength {
+		return nil, fmt.Errorf("strict: records size %d does not match payload length %d", read, payloadLength)
+	}
+
+	return records, err
+}
+
+// isText reports whether buf looks like the start of a text response, printable ASCII or line endings, like the
+// "200 ok" of the FIFO protocol or the "{" of JSON.
+func isText(buf []byte) bool {
+	for _, b := range buf {
+		if (b < 0x20 || b > 0x7e) && b != '\t' && b != '\r' && b != '\n' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeInt returns the big endian int in buf. Ints are usually 1 to 4 bytes, decoded without a loop.
+// Ints are signed 32 bits in Kamailio: 4 bytes are sign extended, and only the last 4 bytes of a longer int are kept,
+// so that the value is the same whatever the size of int on the platform.
+func decodeInt(buf []byte) int {
+	switch len(buf) {
+	case 1:
+		return int(buf[0])
+	case 2:
+		return int(binary.BigEndian.Uint16(buf))
+	case 4:
+		return int(int32(binary.BigEndian.Uint32(buf)))
+	}
+
+	var n uint32
+
+	for _, b := range buf {
+		n = n<<8 | uint32(b)
+	}
+
+	return int(int32(n))
+}
+
+// readNestedRecord is like ReadRecord for a record expected inside a frame, where io.EOF means the frame is truncated.
+func (dec *Decoder) readNestedRecord() (*Record, error) {
+	record, err := dec.ReadRecord()
+
+	if err == io.EOF {
+		return nil, fmt.Errorf("cannot read record header: %w", io.ErrUnexpectedEOF)
+	}
+
+	return record, err
+}
+
+// preallocatedSize is the largest buffer allocated before reading, sizes announced by a peer are not trusted above.
+const preallocatedSize = 64 * 1024
+
+// readBytes reads exactly size bytes. Above preallocatedSize, the buffer grows with the data read, so that a bogus size
+// in a corrupted packet does not allocate a huge buffer for nothing.
+func (dec *Decoder) readBytes(size int) ([]byte, error) {
+	if size <= preallocatedSize {
+		buf := make([]byte, size)
+
+		return buf, dec.readFull(buf)
+	}
+
+	var buffer bytes.Buffer
+
+	if _, err := io.CopyN(&buffer, dec.r, int64(size)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for io.EOF, read in the middle of a frame, and err otherwise.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// readFull reads exactly len(buf) bytes. It is called in the middle of a frame, so io.EOF becomes io.ErrUnexpectedEOF.
+func (dec *Decoder) readFull(buf []byte) error {
+	_, err := io.ReadFull(dec.r, buf)
+
+	return unexpectedEOF(err)
+}
@@ -0,0 +1,130 @@
+package binrpc
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// DialplanMatchEqual, DialplanMatchRegex and DialplanMatchFnmatch are the match operators of a dialplan rule.
+const (
+	DialplanMatchEqual   = 0
+	DialplanMatchRegex   = 1
+	DialplanMatchFnmatch = 2
+)
+
+// DialplanRule is a translation rule of the dialplan module, as returned by "dialplan.dump".
+type DialplanRule struct {
+	DPID     int
+	Priority int
+	MatchOp  int
+	MatchExp string
+	MatchLen int
+	SubstExp string
+	ReplExp  string
+	Attrs    string
+}
+
+// DialplanDump calls "dialplan.dump" and returns the rules of dpid.
+// An unknown dpid or an empty ruleset returns no rules and no error.
+func DialplanDump(conn io.ReadWriter, dpid int) ([]DialplanRule, error) {
+	records, err := Call(conn, "dialplan.dump", Record{Type: TypeInt, Value: dpid})
+
+	var rpcErr *RPCError
+
+	if errors.As(err, &rpcErr) && strings.Contains(rpcErr.Message, "not matched") {
+		// the dpid has no rules loaded
+		return []DialplanRule{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rules := []DialplanRule{}
+
+	if len(records) == 0 {
+		return rules, nil
+	}
+
+	items, err := records[0].StructItems()
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := dpid
+
+	for _, item := range items {
+		switch item.Key {
+		case "DPID":
+			if err := item.Value.Scan(&id); err != nil {
+				return nil, err
+			}
+		case "ENTRIES":
+			entries, err := item.Value.Array()
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range entries {
+				rule, err := newDialplanRule(entry)
+
+				if err != nil {
+					return nil, err
+				}
+
+				rules = append(rules, *rule)
+			}
+		}
+	}
+
+	for i := range rules {
+		rules[i].DPID = id
+	}
+
+	return rules, nil
+}
+
+// DialplanReload calls "dialplan.reload" to reload the rules from the database.
+func DialplanReload(conn io.ReadWriter) error {
+	return Reload(conn, "dialplan.reload")
+}
+
+func newDialplanRule(record Record) (*DialplanRule, error) {
+	items, err := record.StructItems()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rule := DialplanRule{}
+
+	for _, item := range items {
+		var dest any
+
+		switch item.Key {
+		case "PRIO":
+			dest = &rule.Priority
+		case "MATCHOP":
+			dest = &rule.MatchOp
+		case "MATCHEXP":
+			dest = &rule.MatchExp
+		case "MATCHLEN":
+			dest = &rule.MatchLen
+		case "SUBSTEXP":
+			dest = &rule.SubstExp
+		case "REPLEXP":
+			dest = &rule.ReplExp
+		case "ATTRS":
+			dest = &rule.Attrs
+		default:
+			continue
+		}
+
+		if err := item.Value.Scan(dest); err != nil {
+			return nil, err
+		}
+	}
+
+	return &rule, nil
+}
@@ -0,0 +1,73 @@
+package binrpc
+
+import (
+	"testing"
+)
+
+func TestDialplanDump(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method != "dialplan.dump" {
+			return fault(500, "command "+method+" not found")
+		}
+
+		rule := Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "PRIO", Value: Record{Type: TypeInt, Value: 10}},
+			{Key: "MATCHOP", Value: Record{Type: TypeInt, Value: DialplanMatchRegex}},
+			{Key: "MATCHEXP", Value: Record{Type: TypeString, Value: "^0([0-9]+)$"}},
+			{Key: "MATCHLEN", Value: Record{Type: TypeInt, Value: 0}},
+			{Key: "SUBSTEXP", Value: Record{Type: TypeString, Value: "^0([0-9]+)$"}},
+			{Key: "REPLEXP", Value: Record{Type: TypeString, Value: "+33\\1"}},
+			{Key: "ATTRS", Value: Record{Type: TypeString, Value: "national"}},
+		}}
+
+		return PacketReply, []Record{
+			{Type: TypeStruct, Value: []StructItem{
+				{Key: "DPID", Value: request[1]},
+				{Key: "ENTRIES", Value: Record{Type: TypeArray, Value: []Record{rule, rule}}},
+			}},
+		}
+	})
+
+	rules, err := DialplanDump(conn, 3)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+
+	rule := rules[0]
+
+	if rule.DPID != 3 || rule.Priority != 10 || rule.MatchOp != DialplanMatchRegex {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+	if rule.MatchExp != "^0([0-9]+)$" || rule.ReplExp != "+33\\1" || rule.Attrs != "national" {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+}
+
+func TestDialplanDumpEmpty(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return fault(500, "Dialplan ID not matched")
+	})
+
+	rules, err := DialplanDump(conn, 42)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules == nil || len(rules) != 0 {
+		t.Errorf("expected an empty ruleset, got %v", rules)
+	}
+}
+
+func TestDialplanReload(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, nil
+	})
+
+	if err := DialplanReload(conn); err != nil {
+		t.Error(err)
+	}
+}
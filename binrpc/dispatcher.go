@@ -0,0 +1,178 @@
+package binrpc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DispatcherDest is a destination of a set of the dispatcher module, as returned by "dispatcher.list".
+// Flags is the state of the destination, like "AP", see DispatcherState.
+type DispatcherDest struct {
+	URI      string `binrpc:"URI"`
+	Flags    string `binrpc:"FLAGS"`
+	Priority int    `binrpc:"PRIORITY"`
+	Attrs    Record `binrpc:"ATTRS"`
+}
+
+// DispatcherSet is a set of destinations of the dispatcher module.
+type DispatcherSet struct {
+	ID    int
+	Dests []DispatcherDest
+}
+
+// DispatcherState is the state of a destination, the first letter of its flags.
+type DispatcherState string
+
+// States of a destination of the dispatcher module.
+const (
+	DispatcherActive   DispatcherState = "active"
+	DispatcherInactive DispatcherState = "inactive"
+	DispatcherDisabled DispatcherState = "disabled"
+	DispatcherTrying   DispatcherState = "trying"
+)
+
+// DestHealth is the health of a destination of the dispatcher module, decoded from its flags by DispatcherHealth.
+//
+// Up is true when the destination receives traffic: active, or trying after failures without reaching the
+// threshold of the inactive state. Probing is true when the destination is probed with keep-alive requests, the "P"
+// of the flags "AP" or "IP".
+type DestHealth struct {
+	SetID   int
+	URI     string
+	Flags   string
+	State   DispatcherState
+	Probing bool
+	Up      bool
+}
+
+// DispatcherList calls "dispatcher.list" and returns the sets of destinations of the dispatcher module.
+//
+// Depending on the version of Kamailio, the sets and the destinations are arrays of structs or structs repeating the
+// keys "SET" and "DEST": both are decoded.
+func DispatcherList(conn io.ReadWriter) ([]DispatcherSet, error) {
+	var list struct {
+		Records Record `binrpc:"RECORDS"`
+	}
+
+	if err := callStruct(conn, &list, "dispatcher.list"); err != nil {
+		return nil, err
+	}
+
+	sets := []DispatcherSet{}
+
+	records, err := repeatedKey(list.Records, "SET")
+
+	if err != nil {
+		return nil, fmt.Errorf("RECORDS: %w", err)
+	}
+
+	for i, record := range records {
+		var set struct {
+			ID      int    `binrpc:"ID"`
+			Targets Record `binrpc:"TARGETS"`
+		}
+
+		if err := record.Scan(&set); err != nil {
+			return nil, fmt.Errorf("set %d: %w", i, err)
+		}
+
+		dests, err := repeatedKey(set.Targets, "DEST")
+
+		if err != nil {
+			return nil, fmt.Errorf("set %d: TARGETS: %w", set.ID, err)
+		}
+
+		result := DispatcherSet{ID: set.ID, Dests: make([]DispatcherDest, len(dests))}
+
+		for j := range dests {
+			if err := dests[j].Scan(&result.Dests[j]); err != nil {
+				return nil, fmt.Errorf("set %d: dest %d: %w", set.ID, j, err)
+			}
+		}
+
+		sets = append(sets, result)
+	}
+
+	return sets, nil
+}
+
+// DispatcherHealth calls "dispatcher.list", and returns the health of each destination, for a check that all the
+// destinations are up.
+func DispatcherHealth(conn io.ReadWriter) ([]DestHealth, error) {
+	sets, err := DispatcherList(conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	health := []DestHealth{}
+
+	for _, set := range sets {
+		for _, dest := range set.Dests {
+			health = append(health, newDestHealth(set.ID, dest))
+		}
+	}
+
+	return health, nil
+}
+
+// newDestHealth decodes the flags of dest, like "AP": the first letter is the state, the second "P" when probing or
+// "X" when not.
+func newDestHealth(setID int, dest DispatcherDest) DestHealth {
+	health := DestHealth{SetID: setID, URI: dest.URI, Flags: dest.Flags}
+
+	if len(dest.Flags) > 0 {
+		switch dest.Flags[0] {
+		case 'A':
+			health.State = DispatcherActive
+		case 'I':
+			health.State = DispatcherInactive
+		case 'D':
+			health.State = DispatcherDisabled
+		case 'T':
+			health.State = DispatcherTrying
+		}
+	}
+
+	health.Probing = len(dest.Flags) > 1 && dest.Flags[1] == 'P'
+	health.Up = health.State == DispatcherActive || health.State == DispatcherTrying
+
+	return health
+}
+
+// repeatedKey returns the values of key in record, a struct repeating key, or an array of structs with key. Keys are
+// matched case insensitively. An empty record, like a key missing from the response, has no values.
+func repeatedKey(record Record, key string) ([]Record, error) {
+	var values []Record
+
+	switch record.Type {
+	case TypeStruct:
+		items, _ := record.StructItems()
+
+		for _, item := range items {
+			if strings.EqualFold(item.Key, key) {
+				values = append(values, item.Value)
+			}
+		}
+	case TypeArray:
+		items, _ := record.Array()
+
+		for _, item := range items {
+			wrapped, err := repeatedKey(item, key)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, wrapped...)
+		}
+	default:
+		if record.Value != nil {
+			return nil, fmt.Errorf("type error: expected a struct or an array, got %s (%d)", TypeName(record.Type),
+				record.Type)
+		}
+	}
+
+	return values, nil
+}
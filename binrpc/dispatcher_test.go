@@ -0,0 +1,75 @@
+package binrpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDispatcherHealth(t *testing.T) {
+	_, response, err := DecodePacket(readGolden(t, "testdata/golden/dispatcher_list_reply.hex"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, response
+	})
+
+	health, err := DispatcherHealth(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DestHealth{
+		{SetID: 1, URI: "sip:10.0.0.1:5060", Flags: "AP", State: DispatcherActive, Probing: true, Up: true},
+		{SetID: 1, URI: "sip:10.0.0.2:5060", Flags: "IP", State: DispatcherInactive, Probing: true},
+		{SetID: 2, URI: "sip:10.0.1.1:5060", Flags: "DX", State: DispatcherDisabled},
+		{SetID: 2, URI: "sip:10.0.1.2:5060", Flags: "TP", State: DispatcherTrying, Probing: true, Up: true},
+		{SetID: 2, URI: "sip:10.0.1.3:5060", Flags: "AX", State: DispatcherActive, Up: true},
+	}
+
+	if !reflect.DeepEqual(health, expected) {
+		t.Errorf("expected %+v, got %+v", expected, health)
+	}
+}
+
+func TestDispatcherListRepeatedKeys(t *testing.T) {
+	// older versions repeat the SET and DEST keys in structs
+	response := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "NRSETS", Value: NewInt(1)},
+		{Key: "RECORDS", Value: Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "SET", Value: testDispatcherSetRecord(3,
+				testDispatcherDestRecord("sip:10.0.0.1:5060", "AP", 50),
+				testDispatcherDestRecord("sip:10.0.0.2:5060", "IX", 50),
+			)},
+		}}},
+	}}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{response}
+	})
+
+	sets, err := DispatcherList(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sets) != 1 || sets[0].ID != 3 || len(sets[0].Dests) != 2 {
+		t.Fatalf("unexpected sets %+v", sets)
+	}
+	if dest := sets[0].Dests[1]; dest.URI != "sip:10.0.0.2:5060" || dest.Flags != "IX" || !dest.Attrs.IsStruct() {
+		t.Errorf("unexpected destination %+v", dest)
+	}
+
+	// no destination
+	conn = serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{{Key: "NRSETS", Value: NewInt(0)}}}}
+	})
+
+	if health, err := DispatcherHealth(conn); err != nil || len(health) != 0 {
+		t.Errorf("expected no destination, got %+v %v", health, err)
+	}
+}
@@ -0,0 +1,138 @@
+package binrpc
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EncodeValue encodes v as a Record, according to its kind, and writes it to w. It is meant for frameworks holding
+// values as reflect.Value, and is the reflection counterpart of Scan:
+//
+//   - strings, ints, uints and floats are encoded as string, int and double records, bools as the ints 1 and 0, and
+//     a time.Duration as an int number of seconds like in Args
+//   - slices and arrays are encoded as arrays, a nil slice as an empty array
+//   - maps with string keys are encoded as structs, sorted by key
+//   - structs are encoded as structs, their exported fields named by the "binrpc" tag like in Scan, in their order
+//   - pointers and interfaces are encoded as the value they point to, and a Record as it is
+//
+// The encoding is recursive, like the decoding of Scan: a struct with a field of type []SubStruct is encoded as a struct
+// holding an array of structs, and a field of type map[string]int as a nested struct, so a whole request model is
+// encoded in one call, and Scan decodes it back into the same Go type.
+//
+// A nil pointer or interface, and the other kinds like channels and functions, return an error.
+func EncodeValue(w io.Writer, v reflect.Value) error {
+	record, err := recordOf(v)
+
+	if err != nil {
+		return err
+	}
+
+	return record.Encode(w)
+}
+
+// recordOf converts v into a Record, see EncodeValue.
+func recordOf(v reflect.Value) (Record, error) {
+	if !v.IsValid() {
+		return Record{}, fmt.Errorf("invalid value")
+	}
+
+	switch v.Type() {
+	case recordType:
+		record := v.Interface().(Record)
+		return record, record.Validate()
+	case durationType:
+		return NewDuration(time.Duration(v.Int()), time.Second)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return NewString(v.String()), nil
+	case reflect.Bool:
+		return NewBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+
+		if int64(int(n)) != n {
+			return Record{}, fmt.Errorf("%d overflows int", n)
+		}
+
+		return NewInt(int(n)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := v.Uint()
+
+		if n > math.MaxInt {
+			return Record{}, fmt.Errorf("%d overflows int", n)
+		}
+
+		return NewInt(int(n)), nil
+	case reflect.Float32, reflect.Float64:
+		return NewDouble(v.Float()), nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return Record{}, fmt.Errorf("nil %s", v.Type())
+		}
+
+		return recordOf(v.Elem())
+	case reflect.Slice, reflect.Array:
+		items := make([]Record, 0, v.Len())
+
+		for i := 0; i < v.Len(); i++ {
+			item, err := recordOf(v.Index(i))
+
+			if err != nil {
+				return Record{}, fmt.Errorf("item %d: %w", i, err)
+			}
+
+			items = append(items, item)
+		}
+
+		return Record{Type: TypeArray, Value: items}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return Record{}, fmt.Errorf("type %s not implemented: keys must be strings", v.Type())
+		}
+
+		keys := v.MapKeys()
+
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		items := make([]StructItem, 0, len(keys))
+
+		for _, key := range keys {
+			value, err := recordOf(v.MapIndex(key))
+
+			if err != nil {
+				return Record{}, fmt.Errorf("%s: %w", key.String(), err)
+			}
+
+			items = append(items, StructItem{Key: key.String(), Value: value})
+		}
+
+		return Record{Type: TypeStruct, Value: items}, nil
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		items := make([]StructItem, 0, len(fields))
+
+		for _, field := range fields {
+			value, err := recordOf(v.Field(field.index))
+
+			if err != nil {
+				return Record{}, fmt.Errorf("%s: %w", field.name, err)
+			}
+
+			items = append(items, StructItem{Key: field.name, Value: value})
+		}
+
+		return Record{Type: TypeStruct, Value: items}, nil
+	}
+
+	return Record{}, fmt.Errorf("type %s not implemented", v.Type())
+}
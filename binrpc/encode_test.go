@@ -0,0 +1,142 @@
+package binrpc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeValue(t *testing.T) {
+	type point struct {
+		X      int `binrpc:"x"`
+		Y      int `binrpc:"y"`
+		hidden int
+		Skip   string `binrpc:"-"`
+	}
+
+	n := 42
+
+	tests := []struct {
+		value    any
+		expected Record
+	}{
+		{"bonjour", NewString("bonjour")},
+		{int8(-8), NewInt(-8)},
+		{int64(64), NewInt(64)},
+		{uint16(16), NewInt(16)},
+		{float32(1.5), NewDouble(1.5)},
+		{2.25, NewDouble(2.25)},
+		{true, NewInt(1)},
+		{&n, NewInt(42)},
+		{[]string{"a", "b"}, Record{Type: TypeArray, Value: []Record{NewString("a"), NewString("b")}}},
+		{[]int(nil), Record{Type: TypeArray, Value: []Record{}}},
+		{[2]int{1, 2}, Record{Type: TypeArray, Value: []Record{NewInt(1), NewInt(2)}}},
+		{map[string]int{"b": 2, "a": 1}, Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "a", Value: NewInt(1)},
+			{Key: "b", Value: NewInt(2)},
+		}}},
+		{point{X: 1, Y: 2, hidden: 3, Skip: "skip"}, Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "x", Value: NewInt(1)},
+			{Key: "y", Value: NewInt(2)},
+		}}},
+		{[]*point{{X: 1}}, Record{Type: TypeArray, Value: []Record{{Type: TypeStruct, Value: []StructItem{
+			{Key: "x", Value: NewInt(1)},
+			{Key: "y", Value: NewInt(0)},
+		}}}}},
+		{[]any{"a", 1}, Record{Type: TypeArray, Value: []Record{NewString("a"), NewInt(1)}}},
+		{NewString("record"), NewString("record")},
+	}
+
+	for _, test := range tests {
+		var buffer, expected bytes.Buffer
+
+		if err := EncodeValue(&buffer, reflect.ValueOf(test.value)); err != nil {
+			t.Errorf("%T: %v", test.value, err)
+			continue
+		}
+		if err := test.expected.Encode(&expected); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buffer.Bytes(), expected.Bytes()) {
+			t.Errorf("%T: expected %x, got %x", test.value, expected.Bytes(), buffer.Bytes())
+		}
+	}
+
+	var nilPointer *point
+
+	for _, value := range []reflect.Value{
+		reflect.ValueOf(make(chan int)),
+		reflect.ValueOf(func() {}),
+		reflect.ValueOf(map[int]int{1: 1}),
+		reflect.ValueOf(nilPointer),
+		reflect.ValueOf([]any{nil}),
+		{},
+	} {
+		if err := EncodeValue(io.Discard, value); err == nil {
+			t.Errorf("%v: expected an error", value)
+		}
+	}
+}
+
+func TestEncodeValueNested(t *testing.T) {
+	type dest struct {
+		URI      string `binrpc:"uri"`
+		Priority int    `binrpc:"priority"`
+	}
+
+	type batch struct {
+		Set     int            `binrpc:"set"`
+		Dests   []dest         `binrpc:"dests"`
+		Weights map[string]int `binrpc:"weights"`
+	}
+
+	value := batch{
+		Set:     1,
+		Dests:   []dest{{URI: "sip:10.0.0.1", Priority: 10}, {URI: "sip:10.0.0.2"}},
+		Weights: map[string]int{"sip:10.0.0.2": 20, "sip:10.0.0.1": 80},
+	}
+
+	expected := NewStruct(
+		StructItem{Key: "set", Value: NewInt(1)},
+		StructItem{Key: "dests", Value: Record{Type: TypeArray, Value: []Record{
+			NewStruct(StructItem{Key: "uri", Value: NewString("sip:10.0.0.1")}, StructItem{Key: "priority", Value: NewInt(10)}),
+			NewStruct(StructItem{Key: "uri", Value: NewString("sip:10.0.0.2")}, StructItem{Key: "priority", Value: NewInt(0)}),
+		}}},
+		StructItem{Key: "weights", Value: NewStruct(
+			StructItem{Key: "sip:10.0.0.1", Value: NewInt(80)},
+			StructItem{Key: "sip:10.0.0.2", Value: NewInt(20)},
+		)},
+	)
+
+	var buffer, expectedBuffer bytes.Buffer
+
+	if err := EncodeValue(&buffer, reflect.ValueOf(value)); err != nil {
+		t.Fatal(err)
+	}
+	if err := expected.Encode(&expectedBuffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buffer.Bytes(), expectedBuffer.Bytes()) {
+		t.Errorf("expected %x, got %x", expectedBuffer.Bytes(), buffer.Bytes())
+	}
+
+	// Scan decodes the encoded value back
+	record, err := ReadRecord(&buffer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded batch
+
+	if err := record.Scan(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("expected %+v, got %+v", value, decoded)
+	}
+}
@@ -0,0 +1,236 @@
+package binrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HTableSetError is returned by HTableSetMany when some keys could not be set. Errors holds the error of each key
+// that failed, the other keys were set.
+type HTableSetError struct {
+	Errors map[string]error
+}
+
+func (err *HTableSetError) Error() string {
+	keys := err.Keys()
+	messages := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		messages = append(messages, key+": "+err.Errors[key].Error())
+	}
+
+	return "cannot set htable keys: " + strings.Join(messages, "; ")
+}
+
+// Keys returns the keys that failed, sorted.
+func (err *HTableSetError) Keys() []string {
+	keys := make([]string, 0, len(err.Errors))
+
+	for key := range err.Errors {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Unwrap returns the errors of the keys, sorted by key, for errors.Is and errors.As.
+func (err *HTableSetError) Unwrap() []error {
+	errs := make([]error, 0, len(err.Errors))
+
+	for _, key := range err.Keys() {
+		errs = append(errs, err.Errors[key])
+	}
+
+	return errs
+}
+
+// HTableSetMany sets the keys of kv in the htable table, with "htable.seti" for the int values and "htable.sets" for
+// the string values. A bool is set as the int 1 or 0, and a time.Duration as an int number of seconds.
+//
+// When conn is a net.Conn, the calls are pipelined: all the requests are written, while the responses are read in
+// order, so setting many keys takes about one round trip. Each request must be written within DefaultTimeout, the
+// deadlines of conn are reset afterwards. On another connection, like one of NewConn, the keys are set one call after
+// the other.
+//
+// The keys are not set atomically: if some keys fail, the others are set, and the keys that failed are reported with
+// an *HTableSetError. If the connection fails, the keys without response are reported with the error of the
+// connection, which cannot be reused.
+func HTableSetMany(conn io.ReadWriter, table string, kv map[string]any) error {
+	keys := make([]string, 0, len(kv))
+
+	for key := range kv {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	failed := map[string]error{}
+
+	var calls []htableSet
+
+	for _, key := range keys {
+		value, err := newArg(kv[key])
+
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+
+		var method string
+
+		switch value.Type {
+		case TypeInt:
+			method = "htable.seti"
+		case TypeString:
+			method = "htable.sets"
+		default:
+			failed[key] = fmt.Errorf("type error: cannot set %s (%d) in an htable, expected int or string",
+				TypeName(value.Type), value.Type)
+			continue
+		}
+
+		calls = append(calls, htableSet{key: key, method: method, args: []Record{NewString(table), NewString(key), value}})
+	}
+
+	var err error
+
+	if netConn, ok := conn.(net.Conn); ok {
+		err = htableSetPipelined(netConn, calls, failed)
+	} else {
+		err = htableSetSequential(conn, calls, failed)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return &HTableSetError{Errors: failed}
+	}
+
+	return nil
+}
+
+// htableWriteTimeout is the time to write each request of HTableSetMany on a net.Conn.
+var htableWriteTimeout = DefaultTimeout
+
+// htableSet is a call of HTableSetMany setting key.
+type htableSet struct {
+	key    string
+	method string
+	args   []Record
+}
+
+// htableSetSequential makes calls one after the other on conn, and adds the errors of the keys to failed. When the
+// connection fails, the keys left are failed with its error.
+func htableSetSequential(conn io.ReadWriter, calls []htableSet, failed map[string]error) error {
+	for i, call := range calls {
+		_, err := Call(conn, call.method, call.args...)
+
+		var rpcErr *RPCError
+
+		if err != nil && !errors.As(err, &rpcErr) {
+			for _, call := range calls[i:] {
+				failed[call.key] = err
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			failed[call.key] = err
+		}
+	}
+
+	return nil
+}
+
+// htableSetPipelined writes the requests of calls on conn while reading their responses, and adds the errors of the
+// keys to failed. When the connection fails, the keys without response are failed with its error.
+func htableSetPipelined(conn net.Conn, calls []htableSet, failed map[string]error) error {
+	var requests []bytes.Buffer
+	var sent []htableSet
+	var cookies []uint32
+
+	for _, call := range calls {
+		var request bytes.Buffer
+
+		cookie, err := writeRequest(&request, call.method, call.args)
+
+		if err != nil {
+			failed[call.key] = err
+			continue
+		}
+
+		requests = append(requests, request)
+		sent = append(sent, call)
+		cookies = append(cookies, cookie)
+	}
+
+	if len(sent) == 0 {
+		return nil
+	}
+
+	// the requests are written while the responses are read, so that a peer answering each request before reading the
+	// next one does not block. A peer that stops reading fails the write on its deadline, which unblocks the reads.
+	written := make(chan error, 1)
+
+	go func() {
+		for i := range requests {
+			if err := conn.SetWriteDeadline(time.Now().Add(htableWriteTimeout)); err != nil {
+				written <- err
+				return
+			}
+
+			if _, err := requests[i].WriteTo(conn); err != nil {
+				conn.SetReadDeadline(time.Now())
+				written <- err
+				return
+			}
+		}
+
+		written <- conn.SetWriteDeadline(time.Time{})
+	}()
+
+	dec := NewDecoder(conn)
+
+	for i, call := range sent {
+		_, _, err := decodeResponse(dec, cookies[i])
+
+		var rpcErr *RPCError
+
+		if err != nil && !errors.As(err, &rpcErr) {
+			// the connection failed, the next responses cannot be read: the error of the write, if any, is the cause
+			conn.SetWriteDeadline(time.Now())
+
+			if writeErr := <-written; writeErr != nil {
+				err = writeErr
+			}
+
+			for _, call := range sent[i:] {
+				failed[call.key] = err
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			failed[call.key] = err
+		}
+	}
+
+	// all the responses were read, so all the requests were written
+	if err := <-written; err != nil {
+		return err
+	}
+
+	return conn.SetReadDeadline(time.Time{})
+}
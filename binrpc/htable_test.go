@@ -0,0 +1,149 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTableSetMany(t *testing.T) {
+	table := map[string]Record{}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+		key, _ := request[2].String()
+
+		if key == "locked" {
+			return fault(500, "Unable to set value")
+		}
+
+		if method == "htable.seti" && request[3].Type != TypeInt || method == "htable.sets" && request[3].Type != TypeString {
+			return fault(400, "invalid value type")
+		}
+
+		table[key] = request[3]
+
+		return PacketReply, nil
+	})
+
+	err := HTableSetMany(conn, "flags", map[string]any{
+		"beta":    true,
+		"limit":   100,
+		"locked":  1,
+		"name":    "canary",
+		"invalid": []string{"a"},
+	})
+
+	var setErr *HTableSetError
+
+	if !errors.As(err, &setErr) {
+		t.Fatalf("expected an *HTableSetError, got %v", err)
+	}
+
+	if keys := setErr.Keys(); len(keys) != 2 || keys[0] != "invalid" || keys[1] != "locked" {
+		t.Errorf("expected invalid and locked to fail, got %v", keys)
+	}
+
+	var rpcErr *RPCError
+
+	if !errors.As(setErr.Errors["locked"], &rpcErr) || rpcErr.Code != 500 {
+		t.Errorf("expected the fault of locked, got %v", setErr.Errors["locked"])
+	}
+	if !strings.Contains(err.Error(), "locked: rpc fault 500") {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	if len(table) != 3 || table["beta"].IntOr(0) != 1 || table["limit"].IntOr(0) != 100 || table["name"].StringOr("") != "canary" {
+		t.Errorf("unexpected table %v", table)
+	}
+
+	if err := HTableSetMany(conn, "flags", map[string]any{"limit": 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTableSetManyClosed(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, nil
+	})
+
+	conn.Close()
+
+	var setErr *HTableSetError
+
+	if err := HTableSetMany(conn, "flags", map[string]any{"a": 1, "b": 2}); !errors.As(err, &setErr) || len(setErr.Errors) != 2 {
+		t.Errorf("expected both keys to fail, got %v", err)
+	}
+}
+
+func TestHTableSetManyTransport(t *testing.T) {
+	table := map[string]Record{}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		key, _ := request[2].String()
+		table[key] = request[3]
+
+		return PacketReply, nil
+	})
+
+	kv := map[string]any{}
+
+	for i := 0; i < 8; i++ {
+		kv[fmt.Sprintf("key%d", i)] = i
+	}
+
+	if err := HTableSetMany(NewConn(BINRPCTransport{Conn: conn}), "t", kv); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table) != 8 || table["key7"].IntOr(0) != 7 {
+		t.Errorf("unexpected table %v", table)
+	}
+
+	// a failing transport fails the keys with its error
+	conn.Close()
+
+	var setErr *HTableSetError
+
+	err := HTableSetMany(NewConn(BINRPCTransport{Conn: conn}), "t", map[string]any{"a": 1, "b": 2})
+
+	if !errors.As(err, &setErr) || len(setErr.Errors) != 2 || !errors.Is(setErr.Errors["a"], io.ErrClosedPipe) {
+		t.Errorf("expected both keys to fail with the error of the transport, got %v", err)
+	}
+}
+
+func TestHTableSetManyStalled(t *testing.T) {
+	defer func(timeout time.Duration) { htableWriteTimeout = timeout }(htableWriteTimeout)
+
+	htableWriteTimeout = 50 * time.Millisecond
+
+	// the peer reads nothing and never answers
+	client, server := net.Pipe()
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- HTableSetMany(client, "t", map[string]any{"a": 1, "b": 2})
+	}()
+
+	select {
+	case err := <-done:
+		var setErr *HTableSetError
+
+		if !errors.As(err, &setErr) || len(setErr.Errors) != 2 || !errors.Is(setErr.Errors["a"], os.ErrDeadlineExceeded) {
+			t.Errorf("expected both keys to fail on the deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("HTableSetMany blocked on a peer that stopped reading")
+	}
+}
@@ -0,0 +1,192 @@
+package binrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSONRPCTransport is the Transport of the jsonrpcs module of Kamailio, calling methods over HTTP. URL is the address
+// of the xhttp listener routing to jsonrpc_dispatch, like "http://localhost:5060/RPC". HTTPClient defaults to
+// http.DefaultClient.
+//
+// Arguments are sent as JSON params: ints, doubles and strings as they are, structs as objects and arrays as arrays.
+// The result is converted back to records, keeping the order of the members of objects: integer numbers become ints,
+// other numbers doubles, objects structs, and booleans the ints 1 and 0. jsonrpcs returns the values of a method
+// adding several records in an array, so an array result is returned as its items.
+type JSONRPCTransport struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// jsonRPCRequest is the body of a request.
+type jsonRPCRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params,omitempty"`
+	ID      uint32 `json:"id"`
+}
+
+// jsonRPCResponse is the body of a response, with the result not decoded yet to keep the order of its objects.
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// RoundTrip calls method with args in a JSON-RPC request, sent with ctx. An error in the response is returned as an
+// *RPCError. jsonrpcs replies to a fault with the HTTP status of its code: a response with another status than 2xx is
+// an error, an *RPCError if its body is a JSON-RPC error.
+func (transport *JSONRPCTransport) RoundTrip(ctx context.Context, method string, args []Record) ([]Record, error) {
+	request := jsonRPCRequest{JSONRPC: "2.0", Method: method, ID: newCookie()}
+
+	for _, arg := range args {
+		if err := arg.Validate(); err != nil {
+			return nil, err
+		}
+
+		request.Params = append(request.Params, arg.ToGo())
+	}
+
+	body, err := json.Marshal(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := transport.HTTPClient
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, transport.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	response := jsonRPCResponse{}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error == nil {
+			return nil, fmt.Errorf("http status %s", resp.Status)
+		}
+
+		return nil, &RPCError{Code: response.Error.Code, Message: response.Error.Message}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	if response.Error != nil {
+		return nil, &RPCError{Code: response.Error.Code, Message: response.Error.Message}
+	}
+
+	if len(response.Result) == 0 {
+		return []Record{}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(response.Result))
+	dec.UseNumber()
+
+	result, err := decodeJSONRecord(dec)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid result: %w", err)
+	}
+
+	if result.Type == TypeArray {
+		return result.Value.([]Record), nil
+	}
+
+	return []Record{result}, nil
+}
+
+// decodeJSONRecord decodes the next JSON value of dec as a Record. dec must use numbers.
+func decodeJSONRecord(dec *json.Decoder) (Record, error) {
+	token, err := dec.Token()
+
+	if err == io.EOF {
+		return Record{}, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return Record{}, err
+	}
+
+	switch v := token.(type) {
+	case string:
+		return NewString(v), nil
+	case bool:
+		return NewBool(v), nil
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			f, err := v.Float64()
+			return NewDouble(f), err
+		}
+
+		n, err := strconv.Atoi(string(v))
+		return NewInt(n), err
+	case json.Delim:
+		switch v {
+		case '{':
+			items := []StructItem{}
+
+			for dec.More() {
+				key, err := dec.Token()
+
+				if err != nil {
+					return Record{}, err
+				}
+
+				value, err := decodeJSONRecord(dec)
+
+				if err != nil {
+					return Record{}, err
+				}
+
+				items = append(items, StructItem{Key: key.(string), Value: value})
+			}
+
+			_, err := dec.Token()
+			return Record{Type: TypeStruct, Value: items}, err
+		case '[':
+			items := []Record{}
+
+			for dec.More() {
+				value, err := decodeJSONRecord(dec)
+
+				if err != nil {
+					return Record{}, err
+				}
+
+				items = append(items, value)
+			}
+
+			_, err := dec.Token()
+			return Record{Type: TypeArray, Value: items}, err
+		}
+	case nil:
+		return Record{}, errors.New("null value not supported")
+	}
+
+	return Record{}, fmt.Errorf("unexpected token %v", token)
+}
@@ -0,0 +1,78 @@
+package binrpc
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Latency is the duration of each step of a call, measured with the monotonic clock.
+// ReadDuration includes the processing time of the server.
+type Latency struct {
+	DialDuration  time.Duration
+	WriteDuration time.Duration
+	ReadDuration  time.Duration
+}
+
+// Total returns the duration of the whole call.
+func (latency Latency) Total() time.Duration {
+	return latency.DialDuration + latency.WriteDuration + latency.ReadDuration
+}
+
+// MeasureCall connects to address on network (like "tcp"), calls method with args, and closes the connection.
+// It returns the records of the response and the Latency of each step, attributing time to the network (dial)
+// or to the server (read). Call has no instrumentation, and is not slowed down by this function.
+//
+// The dial and the call are abandoned when ctx is done, so an unreachable host fails on the deadline of ctx instead of
+// the connect timeout of the system: use context.WithTimeout to bound the probe.
+func MeasureCall(ctx context.Context, network, address, method string, args ...Record) (Latency, []Record, error) {
+	latency := Latency{}
+
+	var dialer net.Dialer
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, address)
+	latency.DialDuration = time.Since(start)
+
+	if err != nil {
+		return latency, nil, err
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return latency, nil, err
+		}
+	}
+
+	// a cancelled context unblocks the call by expiring the deadline of the connection
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	defer stop()
+
+	start = time.Now()
+	cookie, err := writeRequest(conn, method, args)
+	latency.WriteDuration = time.Since(start)
+
+	if err != nil {
+		return latency, nil, measureError(ctx, err)
+	}
+
+	start = time.Now()
+	records, err := readResponse(conn, cookie)
+	latency.ReadDuration = time.Since(start)
+
+	return latency, records, measureError(ctx, err)
+}
+
+// measureError returns the error of ctx when err is caused by ctx, like the expired deadline of the connection.
+func measureError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
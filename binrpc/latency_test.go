@@ -0,0 +1,98 @@
+package binrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMeasureCall(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		header, _, err := readPacket(conn, 0)
+
+		if err != nil {
+			return
+		}
+
+		// simulate the processing time of the server
+		time.Sleep(20 * time.Millisecond)
+
+		writePacket(conn, header.Cookie, PacketReply, []Record{{Type: TypeString, Value: "pong"}})
+	}()
+
+	latency, records, err := MeasureCall(context.Background(), "tcp", listener.Addr().String(), "core.echo", Record{Type: TypeString, Value: "pong"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := records[0].String(); s != "pong" {
+		t.Errorf(`expected "pong", got "%s"`, s)
+	}
+	if latency.ReadDuration < 20*time.Millisecond {
+		t.Errorf("read duration %s must include the server processing time", latency.ReadDuration)
+	}
+	if latency.Total() != latency.DialDuration+latency.WriteDuration+latency.ReadDuration {
+		t.Error("total does not match")
+	}
+}
+
+func TestMeasureCallContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// the server accepts the connection and never answers
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		time.Sleep(time.Second)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	if _, _, err := MeasureCall(ctx, "tcp", listener.Addr().String(), "core.echo"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the call took %s, expected to stop on the deadline", elapsed)
+	}
+
+	// a done context fails the dial
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := MeasureCall(ctx, "tcp", listener.Addr().String(), "core.echo"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package binrpc
+
+import (
+	"io"
+)
+
+// Presentity is a presence document published to the presence module, as returned by "presence.presentity_list".
+// Expires is the Unix time when the publication expires.
+type Presentity struct {
+	URI     string `binrpc:"pres"`
+	Event   string `binrpc:"event"`
+	ETag    string `binrpc:"etag"`
+	Expires int    `binrpc:"expires"`
+}
+
+// Watcher is a subscription to a presentity, as returned by "presence.watcher_list". Status is the status of the
+// subscription in the watchers table of the presence module, like WatcherActive.
+type Watcher struct {
+	PresentityURI string `binrpc:"presentity_uri"`
+	URI           string `binrpc:"watcher_uri"`
+	Event         string `binrpc:"event"`
+	Status        int    `binrpc:"status"`
+	Reason        string `binrpc:"reason"`
+}
+
+// Status of a Watcher, the subs_status of the presence module.
+const (
+	WatcherActive     = 1
+	WatcherPending    = 2
+	WatcherTerminated = 3
+	WatcherWaiting    = 4
+)
+
+// PresentityList calls "presence.presentity_list" and returns the presentities of the presence module. The table can
+// be large: PresentityListFunc decodes the presentities one by one instead.
+func PresentityList(conn io.ReadWriter) ([]Presentity, error) {
+	presentities := []Presentity{}
+
+	err := PresentityListFunc(conn, func(presentity Presentity) error {
+		presentities = append(presentities, presentity)
+		return nil
+	})
+
+	return presentities, err
+}
+
+// PresentityListFunc calls "presence.presentity_list", and calls fn with each presentity as it is decoded. When fn
+// returns an error, the rest of the response is skipped and PresentityListFunc returns the error.
+func PresentityListFunc(conn io.ReadWriter, fn func(presentity Presentity) error) error {
+	return callEach(conn, "presence.presentity_list", nil, func(record *Record) error {
+		var presentity Presentity
+
+		if err := record.Scan(&presentity); err != nil {
+			return err
+		}
+
+		return fn(presentity)
+	})
+}
+
+// WatcherList calls "presence.watcher_list" and returns the watchers of the presence module. The table can be large:
+// WatcherListFunc decodes the watchers one by one instead.
+func WatcherList(conn io.ReadWriter) ([]Watcher, error) {
+	watchers := []Watcher{}
+
+	err := WatcherListFunc(conn, func(watcher Watcher) error {
+		watchers = append(watchers, watcher)
+		return nil
+	})
+
+	return watchers, err
+}
+
+// WatcherListFunc calls "presence.watcher_list", and calls fn with each watcher as it is decoded, like
+// PresentityListFunc.
+func WatcherListFunc(conn io.ReadWriter, fn func(watcher Watcher) error) error {
+	return callEach(conn, "presence.watcher_list", nil, func(record *Record) error {
+		var watcher Watcher
+
+		if err := record.Scan(&watcher); err != nil {
+			return err
+		}
+
+		return fn(watcher)
+	})
+}
@@ -0,0 +1,116 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testPresentityRecord(i int) Record {
+	return Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "pres", Value: NewString(fmt.Sprintf("sip:user%d@example.com", i))},
+		{Key: "event", Value: NewString("presence")},
+		{Key: "etag", Value: NewString(fmt.Sprintf("a.%d", i))},
+		{Key: "expires", Value: NewInt(1700000000 + i)},
+	}}
+}
+
+func TestPresentityList(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{testPresentityRecord(1), testPresentityRecord(2)}
+	})
+
+	presentities, err := PresentityList(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Presentity{
+		{URI: "sip:user1@example.com", Event: "presence", ETag: "a.1", Expires: 1700000001},
+		{URI: "sip:user2@example.com", Event: "presence", ETag: "a.2", Expires: 1700000002},
+	}
+
+	if !reflect.DeepEqual(presentities, expected) {
+		t.Errorf("expected %+v, got %+v", expected, presentities)
+	}
+}
+
+func TestPresentityListFunc(t *testing.T) {
+	records := make([]Record, 1000)
+
+	for i := range records {
+		records[i] = testPresentityRecord(i)
+	}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method != "presence.presentity_list" {
+			return fault(500, "command "+method+" not found")
+		}
+
+		return PacketReply, records
+	})
+
+	n := 0
+
+	err := PresentityListFunc(conn, func(presentity Presentity) error {
+		if presentity.ETag != fmt.Sprintf("a.%d", n) {
+			t.Errorf("unexpected presentity %d: %+v", n, presentity)
+		}
+
+		n++
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(records) {
+		t.Errorf("expected %d presentities, got %d", len(records), n)
+	}
+
+	// stopping early skips the rest of the response, the connection is reused
+	stop := errors.New("stop")
+
+	if err := PresentityListFunc(conn, func(Presentity) error { return stop }); err != stop {
+		t.Errorf("expected stop, got %v", err)
+	}
+
+	if _, err := PresentityList(conn); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := WatcherList(conn); !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected ErrMethodNotFound, got %v", err)
+	}
+}
+
+func TestWatcherList(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		// the watchers in an array
+		return PacketReply, []Record{{Type: TypeArray, Value: []Record{
+			{Type: TypeStruct, Value: []StructItem{
+				{Key: "presentity_uri", Value: NewString("sip:alice@example.com")},
+				{Key: "watcher_uri", Value: NewString("sip:bob@example.com")},
+				{Key: "event", Value: NewString("presence")},
+				{Key: "status", Value: NewInt(WatcherActive)},
+			}},
+		}}}
+	})
+
+	watchers, err := WatcherList(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Watcher{
+		{PresentityURI: "sip:alice@example.com", URI: "sip:bob@example.com", Event: "presence", Status: WatcherActive},
+	}
+
+	if !reflect.DeepEqual(watchers, expected) {
+		t.Errorf("expected %+v, got %+v", expected, watchers)
+	}
+}
@@ -0,0 +1,108 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotSet is returned when a variable is not set, which is not a failure of the call.
+var ErrNotSet = errors.New("variable not set")
+
+// SharedVar is a shared variable ($shv) of the pv module, as returned by "pv.shvGet".
+// Type is "int" or "string", and Value the int or string Record.
+//
+// AVPs and XAVPs belong to a message or a transaction, so they cannot be inspected by RPC: shared variables are the
+// variables of the configuration readable and writable at any time.
+type SharedVar struct {
+	Name  string `binrpc:"name"`
+	Type  string `binrpc:"type"`
+	Value Record `binrpc:"value"`
+}
+
+// SHVGet calls "pv.shvGet" and returns the shared variable name, or ErrNotSet if it does not exist.
+func SHVGet(conn io.ReadWriter, name string) (SharedVar, error) {
+	records, err := shvGet(conn, NewString(name))
+
+	if err != nil {
+		return SharedVar{}, err
+	}
+
+	if len(records) == 0 {
+		return SharedVar{}, ErrNotSet
+	}
+
+	variable := SharedVar{}
+
+	if err := records[0].Scan(&variable); err != nil {
+		return SharedVar{}, err
+	}
+
+	return variable, nil
+}
+
+// SHVGetAll calls "pv.shvGet" without name, and returns all the shared variables.
+func SHVGetAll(conn io.ReadWriter) ([]SharedVar, error) {
+	records, err := shvGet(conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []SharedVar{}
+
+	for _, record := range records {
+		// all the variables are returned in a struct repeating the key "shv"
+		items, err := repeatedKey(record, "shv")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			variable := SharedVar{}
+
+			if err := item.Scan(&variable); err != nil {
+				return nil, err
+			}
+
+			variables = append(variables, variable)
+		}
+	}
+
+	return variables, nil
+}
+
+// shvGet calls "pv.shvGet" with args, and returns ErrNotSet for the fault of a variable that does not exist.
+func shvGet(conn io.ReadWriter, args ...Record) ([]Record, error) {
+	records, err := Call(conn, "pv.shvGet", args...)
+
+	var rpcErr *RPCError
+
+	if errors.As(err, &rpcErr) && rpcErr.Code == FaultNotFound {
+		return nil, ErrNotSet
+	} else if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// SHVSet calls "pv.shvSet" to set the shared variable name to value, an int or a string Record. The type of a string is
+// sent as "str", the name expected by "pv.shvSet".
+func SHVSet(conn io.ReadWriter, name string, value Record) error {
+	var typ string
+
+	switch value.Type {
+	case TypeInt:
+		typ = "int"
+	case TypeString:
+		typ = "str"
+	default:
+		return fmt.Errorf("type error: cannot set a shared variable of type %s (%d)", TypeName(value.Type), value.Type)
+	}
+
+	_, err := Call(conn, "pv.shvSet", NewString(name), NewString(typ), value)
+
+	return err
+}
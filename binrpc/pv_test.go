@@ -0,0 +1,100 @@
+package binrpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func sharedVar(name string, value Record) Record {
+	typ := "int"
+
+	if value.Type == TypeString {
+		typ = "string"
+	}
+
+	return Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "name", Value: NewString(name)},
+		{Key: "type", Value: NewString(typ)},
+		{Key: "value", Value: value},
+	}}
+}
+
+func TestSHVGet(t *testing.T) {
+	variables := map[string]Record{
+		"debug": NewInt(1),
+		"mode":  NewString("maintenance"),
+	}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if len(request) == 1 {
+			return PacketReply, []Record{NewStruct(
+				StructItem{Key: "shv", Value: sharedVar("debug", variables["debug"])},
+				StructItem{Key: "shv", Value: sharedVar("mode", variables["mode"])},
+			)}
+		}
+
+		name, _ := request[1].String()
+
+		if value, ok := variables[name]; ok {
+			return PacketReply, []Record{sharedVar(name, value)}
+		}
+
+		return fault(404, "Variable not found")
+	})
+
+	variable, err := SHVGet(conn, "mode")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := variable.Value.String(); variable.Name != "mode" || variable.Type != "string" || s != "maintenance" {
+		t.Errorf("unexpected variable %+v", variable)
+	}
+
+	if _, err := SHVGet(conn, "bogus"); !errors.Is(err, ErrNotSet) {
+		t.Errorf("expected ErrNotSet, got %v", err)
+	}
+
+	all, err := SHVGetAll(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Value.ToGo() != 1 || all[1].Value.ToGo() != "maintenance" {
+		t.Errorf("unexpected variables %+v", all)
+	}
+
+	// without shared variables, the struct is empty
+	conn = serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{NewStruct()}
+	})
+
+	if all, err := SHVGetAll(conn); err != nil || len(all) != 0 {
+		t.Errorf("expected no variables, got %+v %v", all, err)
+	}
+}
+
+func TestSHVSet(t *testing.T) {
+	var request []Record
+
+	conn := serve(t, func(r []Record) (uint8, []Record) {
+		request = r
+		return PacketReply, []Record{NewString("Ok. Variable set to new value.")}
+	})
+
+	if err := SHVSet(conn, "debug", NewInt(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Record{NewString("pv.shvSet"), NewString("debug"), NewString("int"), NewInt(3)}
+
+	for i := range expected {
+		if !request[i].Equal(expected[i]) {
+			t.Errorf("%d: expected %v, got %v", i, expected[i], request[i])
+		}
+	}
+
+	if err := SHVSet(conn, "debug", NewDouble(1.5)); err == nil {
+		t.Error("expected an error for a double")
+	}
+}
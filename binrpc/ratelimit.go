@@ -0,0 +1,140 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RLAlgorithm is the algorithm of a pipe of the ratelimit module.
+type RLAlgorithm string
+
+// Algorithms of a pipe of the ratelimit module. RLNop is the algorithm of an unused pipe.
+const (
+	RLTailDrop RLAlgorithm = "TAILDROP"
+	RLRed      RLAlgorithm = "RED"
+	RLNetwork  RLAlgorithm = "NETWORK"
+	RLFeedback RLAlgorithm = "FEEDBACK"
+	RLNop      RLAlgorithm = "NOP"
+)
+
+// Known reports whether the algorithm is one of the algorithms of the ratelimit module.
+func (algorithm RLAlgorithm) Known() bool {
+	switch algorithm {
+	case RLTailDrop, RLRed, RLNetwork, RLFeedback, RLNop:
+		return true
+	}
+
+	return false
+}
+
+// RLPipe is a pipe of the ratelimit module. Limit is the number of requests per timer interval, or the target CPU load
+// in percent for the FEEDBACK algorithm. Counter is the number of requests of the current interval. Load is only
+// returned by "rl.stats".
+type RLPipe struct {
+	Name      string      `binrpc:"name"`
+	Algorithm RLAlgorithm `binrpc:"algorithm"`
+	Limit     int         `binrpc:"limit"`
+	Counter   int         `binrpc:"counter"`
+	Load      int         `binrpc:"load"`
+}
+
+// RLPipes calls "rl.get_pipes" and returns the pipes of the ratelimit module.
+func RLPipes(conn io.ReadWriter) ([]RLPipe, error) {
+	return rlPipes(conn, "rl.get_pipes")
+}
+
+// RLStats calls "rl.stats" and returns the load and counter of the pipes of the ratelimit module.
+func RLStats(conn io.ReadWriter) ([]RLPipe, error) {
+	return rlPipes(conn, "rl.stats")
+}
+
+// RLSetPipe calls "rl.set_pipe" to set the algorithm and limit of the pipe name. The algorithm must be known, and the
+// limit positive, at most 100 for the FEEDBACK algorithm.
+func RLSetPipe(conn io.ReadWriter, name string, algorithm RLAlgorithm, limit int) error {
+	if name == "" {
+		return errors.New("missing pipe name")
+	}
+	if !algorithm.Known() {
+		return fmt.Errorf("invalid algorithm %q", algorithm)
+	}
+	if limit < 0 {
+		return fmt.Errorf("invalid limit %d: negative", limit)
+	}
+	if algorithm == RLFeedback && limit > 100 {
+		return fmt.Errorf("invalid limit %d: the FEEDBACK limit is a CPU load in percent", limit)
+	}
+
+	_, err := Call(conn, "rl.set_pipe", NewString(name), NewString(string(algorithm)), NewInt(limit))
+
+	return err
+}
+
+// rlPipes calls method and decodes the pipes of the response: an array of structs, a struct of structs, or a struct
+// repeating the keys of each pipe, each pipe starting with the key "name".
+func rlPipes(conn io.ReadWriter, method string) ([]RLPipe, error) {
+	records, err := Call(conn, method)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pipes := []RLPipe{}
+
+	if len(records) == 0 {
+		return pipes, nil
+	}
+
+	var values []Record
+
+	switch records[0].Type {
+	case TypeArray:
+		values, _ = records[0].Array()
+	case TypeStruct:
+		items, _ := records[0].StructItems()
+		values = rlGroupPipes(items)
+	default:
+		return nil, fmt.Errorf("type error: expected a struct or an array, got %s (%d)", TypeName(records[0].Type),
+			records[0].Type)
+	}
+
+	for i := range values {
+		pipe := RLPipe{}
+
+		if err := values[i].Scan(&pipe); err != nil {
+			return nil, fmt.Errorf("pipe %d: %w", i, err)
+		}
+
+		pipes = append(pipes, pipe)
+	}
+
+	return pipes, nil
+}
+
+// rlGroupPipes returns the pipes of the items of a struct: the struct values, or the groups of items starting with
+// the key "name".
+func rlGroupPipes(items []StructItem) []Record {
+	var pipes []Record
+	var group []StructItem
+
+	for _, item := range items {
+		if item.Value.Type == TypeStruct {
+			pipes = append(pipes, item.Value)
+			continue
+		}
+
+		if strings.EqualFold(item.Key, "name") && group != nil {
+			pipes = append(pipes, Record{Type: TypeStruct, Value: group})
+			group = nil
+		}
+
+		group = append(group, item)
+	}
+
+	if group != nil {
+		pipes = append(pipes, Record{Type: TypeStruct, Value: group})
+	}
+
+	return pipes
+}
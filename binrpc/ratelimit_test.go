@@ -0,0 +1,104 @@
+package binrpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRLPipes(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+
+		switch method {
+		case "rl.get_pipes":
+			// the keys of each pipe repeated in a single struct
+			return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{
+				{Key: "name", Value: NewString("invite")},
+				{Key: "algorithm", Value: NewString("TAILDROP")},
+				{Key: "limit", Value: NewInt(10)},
+				{Key: "counter", Value: NewInt(3)},
+				{Key: "name", Value: NewString("cpu")},
+				{Key: "algorithm", Value: NewString("FEEDBACK")},
+				{Key: "limit", Value: NewInt(80)},
+				{Key: "counter", Value: NewInt(0)},
+			}}}
+		case "rl.stats":
+			return PacketReply, []Record{{Type: TypeArray, Value: []Record{
+				{Type: TypeStruct, Value: []StructItem{
+					{Key: "name", Value: NewString("invite")},
+					{Key: "load", Value: NewInt(30)},
+					{Key: "counter", Value: NewInt(3)},
+				}},
+			}}}
+		}
+
+		return fault(500, "command "+method+" not found")
+	})
+
+	pipes, err := RLPipes(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RLPipe{
+		{Name: "invite", Algorithm: RLTailDrop, Limit: 10, Counter: 3},
+		{Name: "cpu", Algorithm: RLFeedback, Limit: 80},
+	}
+
+	if !reflect.DeepEqual(pipes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, pipes)
+	}
+
+	stats, err := RLStats(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []RLPipe{{Name: "invite", Counter: 3, Load: 30}}; !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestRLSetPipe(t *testing.T) {
+	var args []Record
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		args = request[1:]
+		return PacketReply, nil
+	})
+
+	if err := RLSetPipe(conn, "invite", RLRed, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Record{NewString("invite"), NewString("RED"), NewInt(20)}
+
+	if len(args) != len(expected) {
+		t.Fatalf("expected %d arguments, got %d", len(expected), len(args))
+	}
+
+	for i := range expected {
+		if !args[i].Equal(expected[i]) {
+			t.Errorf("argument %d: expected %v, got %v", i, expected[i], args[i])
+		}
+	}
+
+	invalid := []struct {
+		name      string
+		algorithm RLAlgorithm
+		limit     int
+	}{
+		{"", RLRed, 20},
+		{"invite", "LEAKY", 20},
+		{"invite", RLTailDrop, -1},
+		{"cpu", RLFeedback, 120},
+	}
+
+	for _, test := range invalid {
+		if err := RLSetPipe(conn, test.name, test.algorithm, test.limit); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
@@ -2,10 +2,16 @@ package binrpc
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"reflect"
 	"strconv"
+	"strings"
 )
 
 // Record represents a BINRPC type+size, and Go value. It is not a binary representation of a record.
@@ -27,7 +33,7 @@ type StructItem struct {
 // String returns the string value, or an error if the type is not a string.
 func (record Record) String() (string, error) {
 	if record.Type != TypeString {
-		return "", fmt.Errorf("type error: expected type string (%d), got %d", TypeString, record.Type)
+		return "", fmt.Errorf("type error: expected type string (%d), got %s (%d)", TypeString, TypeName(record.Type), record.Type)
 	}
 
 	return record.Value.(string), nil
@@ -36,7 +42,7 @@ func (record Record) String() (string, error) {
 // Int returns the int value, or an error if the type is not a int.
 func (record Record) Int() (int, error) {
 	if record.Type != TypeInt {
-		return 0, fmt.Errorf("type error: expected type int (%d), got %d", TypeInt, record.Type)
+		return 0, fmt.Errorf("type error: expected type int (%d), got %s (%d)", TypeInt, TypeName(record.Type), record.Type)
 	}
 
 	return record.Value.(int), nil
@@ -45,22 +51,243 @@ func (record Record) Int() (int, error) {
 // Double returns the double value as a float64, or an error if the type is not a double
 func (record Record) Double() (float64, error) {
 	if record.Type != TypeDouble {
-		return 0, fmt.Errorf("type error: expected type double (%d), got %d", TypeDouble, record.Type)
+		return 0, fmt.Errorf("type error: expected type double (%d), got %s (%d)", TypeDouble, TypeName(record.Type), record.Type)
 	}
 
 	return record.Value.(float64), nil
 }
 
+// StringOr returns the string value, or def if the type is not a string.
+func (record Record) StringOr(def string) string {
+	if s, ok := record.Value.(string); ok && record.Type == TypeString {
+		return s
+	}
+
+	return def
+}
+
+// IntOr returns the int value, or def if the type is not an int.
+func (record Record) IntOr(def int) int {
+	if i, ok := record.Value.(int); ok && record.Type == TypeInt {
+		return i
+	}
+
+	return def
+}
+
+// DoubleOr returns the double value as a float64, or def if the type is not a double.
+func (record Record) DoubleOr(def float64) float64 {
+	if f, ok := record.Value.(float64); ok && record.Type == TypeDouble {
+		return f
+	}
+
+	return def
+}
+
 // StructItems returns items for a struct value, or an error if not a struct.
+// The items are in the order of the packet, repeated keys included: decoding never reorders them, unlike the map of
+// ToGo.
 func (record *Record) StructItems() ([]StructItem, error) {
 	if record.Type != TypeStruct {
-		return nil, fmt.Errorf("type error: expected type struct (%d), got %d", TypeStruct, record.Type)
+		return nil, fmt.Errorf("type error: expected type struct (%d), got %s (%d)", TypeStruct, TypeName(record.Type), record.Type)
+	}
+
+	if record.Value == nil {
+		// a struct built without items, like Record{Type: TypeStruct}
+		return []StructItem{}, nil
+	}
+
+	items, ok := record.Value.([]StructItem)
+
+	if !ok {
+		return nil, fmt.Errorf("type error: expected type struct (%d) value, got %T", TypeStruct, record.Value)
+	}
+
+	return items, nil
+}
+
+// AppendStructItems appends the items of a struct value to dst and returns the extended slice, or an error if not a
+// struct. Passing dst[:0] reuses the capacity of dst, to decode the same struct-shaped response repeatedly without
+// allocating. The items are copied: dst does not share its backing array with the record.
+func (record *Record) AppendStructItems(dst []StructItem) ([]StructItem, error) {
+	if record.Type != TypeStruct {
+		return dst, fmt.Errorf("type error: expected type struct (%d), got %s (%d)", TypeStruct, TypeName(record.Type), record.Type)
+	}
+
+	items, _ := record.Value.([]StructItem)
+
+	return append(dst, items...), nil
+}
+
+// Array returns items for an array value, or an error if not an array.
+func (record *Record) Array() ([]Record, error) {
+	if record.Type != TypeArray {
+		return nil, fmt.Errorf("type error: expected type array (%d), got %s (%d)", TypeArray, TypeName(record.Type), record.Type)
+	}
+
+	if encoded, ok := record.Value.(encodedItems); ok {
+		return encoded.decode()
+	}
+
+	if record.Value == nil {
+		// an array built without items, like Record{Type: TypeArray}
+		return []Record{}, nil
+	}
+
+	return record.Value.([]Record), nil
+}
+
+// Keys returns the keys of a struct value in the order of the packet, repeated keys included, or an error if not a
+// struct. It shows the shape of an unknown response without its values.
+func (record *Record) Keys() ([]string, error) {
+	items, err := record.StructItems()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(items))
+
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+
+	return keys, nil
+}
+
+// IsStruct reports whether the record is a struct, with items returned by StructItems.
+func (record Record) IsStruct() bool {
+	return record.Type == TypeStruct
+}
+
+// IsArray reports whether the record is an array, with items returned by Array.
+func (record Record) IsArray() bool {
+	return record.Type == TypeArray
+}
+
+// IsScalar reports whether the record is a single value: an int, a string or a double.
+func (record Record) IsScalar() bool {
+	return record.Type == TypeInt || record.Type == TypeString || record.Type == TypeDouble
+}
+
+// Unwrap returns the only item of an array with one item, like a struct returned by a method wrapping its result in an
+// array. Any other record, including an array with zero or several items, is returned unchanged. Calls never unwrap
+// their results: call Unwrap where this shape is expected.
+func (record Record) Unwrap() Record {
+	if record.Type != TypeArray {
+		return record
+	}
+
+	if items, err := record.Array(); err == nil && len(items) == 1 {
+		return items[0]
+	}
+
+	return record
+}
+
+// AsKeyValue flattens the records of a response listing names and values into a map, whatever their shape: structs
+// of names and values, like {"abc": 1}, structs of pairs, like {"name": "abc", "value": 1}, or strings like "abc 1",
+// "abc = 1" or "abc=1". The records may be in an array, or be the top level records of the response. Values are
+// converted to strings like Scan does. When a name is repeated, its last value is kept.
+func AsKeyValue(records []Record) (map[string]string, error) {
+	kv := map[string]string{}
+
+	for _, record := range records {
+		items := []Record{record}
+
+		if record.Type == TypeArray {
+			items, _ = record.Array()
+		}
+
+		for i := range items {
+			if err := items[i].addKeyValue(kv); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return kv, nil
+}
+
+// addKeyValue adds the names and values of a struct or a string to kv, see AsKeyValue.
+func (record *Record) addKeyValue(kv map[string]string) error {
+	switch record.Type {
+	case TypeString:
+		line := strings.TrimSpace(record.Value.(string))
+
+		// "=" separates the name only in the form "name = value", or after a name without space: in "uri
+		// sip:alice@example.com;transport=tcp", it belongs to the value
+		name, value, ok := strings.Cut(line, " = ")
+
+		if !ok {
+			name, value, ok = strings.Cut(line, "=")
+
+			if strings.ContainsAny(strings.TrimSpace(name), " \t") {
+				ok = false
+			}
+		}
+		if !ok {
+			name, value, ok = strings.Cut(line, " ")
+		}
+
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid name and value %q", line)
+		}
+
+		kv[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	case TypeStruct:
+		items, _ := record.StructItems()
+
+		if len(items) == 2 && strings.EqualFold(items[0].Key, "name") && strings.EqualFold(items[1].Key, "value") {
+			var name, value string
+
+			if err := items[0].Value.Scan(&name); err != nil {
+				return fmt.Errorf("name: %w", err)
+			}
+			if err := items[1].Value.Scan(&value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			kv[name] = value
+
+			return nil
+		}
+
+		for _, item := range items {
+			var value string
+
+			if err := item.Value.Scan(&value); err != nil {
+				return fmt.Errorf("%s: %w", item.Key, err)
+			}
+
+			kv[item.Key] = value
+		}
+	default:
+		return fmt.Errorf("type error: expected a struct or a string, got %s (%d)", TypeName(record.Type), record.Type)
 	}
 
-	return record.Value.([]StructItem), nil
+	return nil
 }
 
-// Scan copies the value in the Record into the values pointed at by dest. Valid dest type are *int, *string, and *[]StructItem
+// Scan copies the value in the Record into the values pointed at by dest. Valid dest type are *int, *string, *float64,
+// *bool, *[]StructItem and *[]Record.
+//
+// As the same value is sent as an int or as a string depending on the version of Kamailio or the module, an int or a
+// double is decoded from a numeric string, ignoring surrounding spaces, and a string from an int or a double rendered
+// as text. This applies to the fields of structs as well, whatever their int type.
+//
+// A bool is decoded from an int, true if not zero, or from the strings sent by some modules: "true", "on", "yes" and
+// "1" for true, "false", "off", "no" and "0" for false, case insensitive. Another string returns an error.
+//
+// Other dest types are decoded using reflection: a struct Record into a pointer to a Go struct or a map with string keys,
+// an array Record into a pointer to a slice, recursively. Struct items are matched to fields by the name in the "binrpc"
+// tag of the field, or by the name of the field (case insensitive). When a key is repeated, all its values are appended
+// to a slice field. As ints are signed 32-bit on the wire, a field with the option "unsigned", like
+// `binrpc:"flags,unsigned"`, decodes an int as a uint32 instead of sign-extending it.
+//
+// Decoding is recursive, so responses nesting arrays of structs inside structs decode into nested Go types. Note that
+// the ctl module sends many lists, like the sets and destinations of "dispatcher.list", as structs repeating a key: they
+// decode into a struct with a slice field for the repeated key.
 func (record *Record) Scan(dest any) error {
 	switch dest.(type) {
 	case *string:
@@ -74,55 +301,358 @@ func (record *Record) Scan(dest any) error {
 		case TypeDouble:
 			*s = fmt.Sprintf("%.3f", record.Value.(float64))
 		default:
-			return fmt.Errorf("type error: cannot convert type %d to string", record.Type)
+			return fmt.Errorf("type error: cannot convert %s (%d) to string", TypeName(record.Type), record.Type)
 		}
 	case *int:
 		i := dest.(*int)
 
 		switch record.Type {
 		case TypeString:
-			if n, err := strconv.Atoi(record.Value.(string)); err == nil {
-				*i = n
-			} else {
-				return err
+			// the same value is an int or a numeric string, depending on the version of Kamailio or the module
+			n, err := strconv.Atoi(strings.TrimSpace(record.Value.(string)))
+
+			if err != nil {
+				return fmt.Errorf("type error: cannot convert string %q to int", record.Value)
 			}
+
+			*i = n
 		case TypeInt:
 			*i = record.Value.(int)
 		default:
-			return fmt.Errorf("type error: cannot convert type %d to int", record.Type)
+			return fmt.Errorf("type error: cannot convert %s (%d) to int", TypeName(record.Type), record.Type)
 		}
 	case *float64:
 		f := dest.(*float64)
 
 		switch record.Type {
 		case TypeString:
-			if value, err := strconv.ParseFloat(record.Value.(string), 64); err == nil {
-				*f = value
-			} else {
-				return err
+			value, err := strconv.ParseFloat(strings.TrimSpace(record.Value.(string)), 64)
+
+			if err != nil {
+				return fmt.Errorf("type error: cannot convert string %q to double", record.Value)
 			}
+
+			*f = value
 		case TypeInt:
 			*f = float64(record.Value.(int))
 		case TypeDouble:
 			*f = record.Value.(float64)
 		default:
-			return fmt.Errorf("type error: cannot convert type %d to double", record.Type)
+			return fmt.Errorf("type error: cannot convert %s (%d) to double", TypeName(record.Type), record.Type)
+		}
+	case *bool:
+		b := dest.(*bool)
+
+		switch record.Type {
+		case TypeInt:
+			*b = record.Value.(int) != 0
+		case TypeString:
+			switch s := record.Value.(string); strings.ToLower(s) {
+			case "true", "on", "yes", "1":
+				*b = true
+			case "false", "off", "no", "0":
+				*b = false
+			default:
+				return fmt.Errorf("type error: cannot convert %q to bool", s)
+			}
+		default:
+			return fmt.Errorf("type error: cannot convert %s (%d) to bool", TypeName(record.Type), record.Type)
 		}
 	case *[]StructItem:
 		if record.Type != TypeStruct {
-			return fmt.Errorf("type error: cannot convert type %d to []StructItem", record.Type)
+			return fmt.Errorf("type error: cannot convert %s (%d) to []StructItem", TypeName(record.Type), record.Type)
 		}
 
-		items := dest.(*[]StructItem)
-		*items = record.Value.([]StructItem)
+		items, err := record.StructItems()
+
+		if err != nil {
+			return err
+		}
+
+		*dest.(*[]StructItem) = items
+	case *[]Record:
+		if record.Type != TypeArray {
+			return fmt.Errorf("type error: cannot convert %s (%d) to []Record", TypeName(record.Type), record.Type)
+		}
+
+		items, err := record.Array()
+
+		if err != nil {
+			return err
+		}
+
+		*dest.(*[]Record) = items
 	default:
-		return errors.New("invalid dest type")
+		return record.scanReflect(dest)
 	}
 
 	return nil
 }
 
+// ScanBase64 decodes the string value, encoded in standard base64 with padding, into dest. It is meant for binary
+// values stored as base64 strings, like in htables. A record that is not a string or is not valid base64 returns an
+// error, and dest is left unchanged.
+func (record *Record) ScanBase64(dest *[]byte) error {
+	s, err := record.String()
+
+	if err != nil {
+		return err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+
+	if err != nil {
+		return fmt.Errorf("invalid base64 value: %w", err)
+	}
+
+	*dest = data
+
+	return nil
+}
+
+// ScanBigInt decodes the value into dest, for counters that may exceed 64 bits sent as decimal strings. An int record
+// is decoded as well. A string that is not a valid decimal integer returns an error, and dest is left unchanged.
+func (record *Record) ScanBigInt(dest *big.Int) error {
+	switch record.Type {
+	case TypeInt:
+		n, err := record.Int()
+
+		if err != nil {
+			return err
+		}
+
+		dest.SetInt64(int64(n))
+
+		return nil
+	case TypeString:
+		s, err := record.String()
+
+		if err != nil {
+			return err
+		}
+
+		n, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
+
+		if !ok {
+			return fmt.Errorf("type error: cannot convert string %q to an integer", s)
+		}
+
+		dest.Set(n)
+
+		return nil
+	}
+
+	return fmt.Errorf("type error: cannot convert %s (%d) to an integer", TypeName(record.Type), record.Type)
+}
+
+// Validate returns an error if the Go type of Value does not match Type, like a TypeInt record with a string value,
+// checking the items of structs and arrays recursively. Such a record would fail only when encoded.
+func (record Record) Validate() error {
+	switch record.Type {
+	case TypeInt:
+		if _, ok := record.Value.(int); !ok {
+			return fmt.Errorf("type error: expected type int (%d) value, got %T", TypeInt, record.Value)
+		}
+	case TypeString, TypeAVP:
+		if _, ok := record.Value.(string); !ok {
+			return fmt.Errorf("type error: expected type string (%d) value, got %T", record.Type, record.Value)
+		}
+	case TypeDouble:
+		if _, ok := record.Value.(float64); !ok {
+			return fmt.Errorf("type error: expected type double (%d) value, got %T", TypeDouble, record.Value)
+		}
+	case TypeStruct:
+		if record.Value == nil {
+			break
+		}
+
+		items, ok := record.Value.([]StructItem)
+
+		if !ok {
+			return fmt.Errorf("type error: expected type struct (%d) value, got %T", TypeStruct, record.Value)
+		}
+
+		for _, item := range items {
+			if err := item.Value.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", item.Key, err)
+			}
+		}
+	case TypeArray:
+		switch items := record.Value.(type) {
+		case nil, encodedItems:
+		case []Record:
+			for i, item := range items {
+				if err := item.Validate(); err != nil {
+					return fmt.Errorf("item %d: %w", i, err)
+				}
+			}
+		default:
+			return fmt.Errorf("type error: expected type array (%d) value, got %T", TypeArray, record.Value)
+		}
+	default:
+		if _, ok := record.Value.(OpaqueValue); !ok || record.Type > 0x0F {
+			return fmt.Errorf("type error: type %s (%d) not implemented", TypeName(record.Type), record.Type)
+		}
+	}
+
+	return nil
+}
+
+// Equal reports whether record and other have the same type and value, comparing structs and arrays item by item.
+// Unlike reflect.DeepEqual, it ignores the size of decoded records, and an empty struct or array equals a nil one.
+func (record Record) Equal(other Record) bool {
+	if record.Type != other.Type {
+		return false
+	}
+
+	record, other = record.withItems(), other.withItems()
+
+	switch value := record.Value.(type) {
+	case []StructItem:
+		otherValue, ok := other.Value.([]StructItem)
+
+		if !ok || len(value) != len(otherValue) {
+			return false
+		}
+
+		for i := range value {
+			if value[i].Key != otherValue[i].Key || !value[i].Value.Equal(otherValue[i].Value) {
+				return false
+			}
+		}
+
+		return true
+	case []Record:
+		otherValue, ok := other.Value.([]Record)
+
+		if !ok || len(value) != len(otherValue) {
+			return false
+		}
+
+		for i := range value {
+			if !value[i].Equal(otherValue[i]) {
+				return false
+			}
+		}
+
+		return true
+	case int, string, float64:
+		return record.Value == other.Value
+	}
+
+	return reflect.DeepEqual(record.Value, other.Value)
+}
+
+// withItems returns record with the value of a struct or an array as returned by StructItems or Array: a nil value has
+// no items, and the items of an ArrayBuilder are decoded. A value that does not match the type is kept as it is.
+func (record Record) withItems() Record {
+	switch record.Type {
+	case TypeStruct:
+		if record.Value == nil {
+			record.Value = []StructItem{}
+		}
+	case TypeArray:
+		switch value := record.Value.(type) {
+		case nil:
+			record.Value = []Record{}
+		case encodedItems:
+			if items, err := value.decode(); err == nil {
+				record.Value = items
+			}
+		}
+	}
+
+	return record
+}
+
+// ToGo returns the value of the record as Go values: int, string or float64 for scalars, map[string]any for structs
+// and []any for arrays, recursively. The values of a key repeated in a struct are gathered in a []any. The order of the
+// items of a struct is lost in the map, use StructItems when it matters.
+//
+// ToGo never fails, which is convenient for logging and debugging: a record of an unknown type, or with a value not
+// matching its type, becomes a string describing it like "<type 6>".
+func (record Record) ToGo() any {
+	return record.toGo(false)
+}
+
+// ToGoNumber is like ToGo, with ints as json.Number instead of int. When bridging to JSON, ints are then kept as they
+// are by a json.Decoder with UseNumber, instead of becoming float64.
+func (record Record) ToGoNumber() any {
+	return record.toGo(true)
+}
+
+func (record Record) toGo(useNumber bool) any {
+	switch record.Type {
+	case TypeInt:
+		if i, ok := record.Value.(int); ok && useNumber {
+			return json.Number(strconv.Itoa(i))
+		}
+
+		return record.Value
+	case TypeString, TypeDouble, TypeAVP:
+		return record.Value
+	case TypeStruct:
+		items, ok := record.withItems().Value.([]StructItem)
+
+		if !ok {
+			break
+		}
+
+		m := make(map[string]any, len(items))
+		repeated := map[string]bool{}
+
+		for _, item := range items {
+			value := item.Value.toGo(useNumber)
+
+			if previous, ok := m[item.Key]; !ok {
+				m[item.Key] = value
+			} else if repeated[item.Key] {
+				m[item.Key] = append(previous.([]any), value)
+			} else {
+				m[item.Key] = []any{previous, value}
+				repeated[item.Key] = true
+			}
+		}
+
+		return m
+	case TypeArray:
+		items, ok := record.withItems().Value.([]Record)
+
+		if !ok {
+			break
+		}
+
+		values := make([]any, 0, len(items))
+
+		for _, item := range items {
+			values = append(values, item.toGo(useNumber))
+		}
+
+		return values
+	}
+
+	return fmt.Sprintf("<type %d>", record.Type)
+}
+
+// Converter converts the value in a Record into the value pointed at by dest.
+type Converter func(record *Record, dest any) error
+
+// Converters maps a dest type (for example reflect.TypeOf((*URI)(nil))) to the Converter used by ScanWith.
+type Converters map[reflect.Type]Converter
+
+// ScanWith is like Scan but consults converters first. If a Converter is registered for the type of dest it is used,
+// otherwise the built-in conversions of Scan apply.
+func (record *Record) ScanWith(dest any, converters Converters) error {
+	if convert, ok := converters[reflect.TypeOf(dest)]; ok {
+		return convert(record, dest)
+	}
+
+	return record.Scan(dest)
+}
+
 // Encode is a low level function that encodes a record and writes it to w.
+// A struct or an array with a nil Value is encoded without items. A string containing a null byte returns an error, as
+// strings are null terminated.
 func (record *Record) Encode(w io.Writer) error {
 	var value bytes.Buffer
 
@@ -141,10 +671,19 @@ func (record *Record) Encode(w io.Writer) error {
 			return err
 		}
 
-		value.Write(intToBytesBE(v))
-	case TypeString:
+		n, err := intToUint32(int64(v))
+
+		if err != nil {
+			return err
+		}
+
+		value.Write(intToBytesBE(n))
+	case TypeString, TypeAVP:
 		if s, ok := record.Value.(string); !ok {
 			return errors.New("type error: expected type string")
+		} else if strings.IndexByte(s, 0x00) != -1 {
+			// Kamailio would silently truncate the string at the null byte
+			return fmt.Errorf("invalid string %q: contains a null byte", s)
 		} else {
 			value.WriteString(s)
 		}
@@ -158,9 +697,78 @@ func (record *Record) Encode(w io.Writer) error {
 			return errors.New("type error: expected type float64")
 		}
 
-		value.Write(intToBytesBE(int(v * 1000)))
+		// the thousandths are a signed int, truncated towards zero like Kamailio. The conversion of a float out of the
+		// range of int64 is not portable, check the range first
+		thousandths := math.Trunc(v * 1000)
+
+		if math.IsNaN(v) || thousandths < math.MinInt32 || thousandths > math.MaxInt32 {
+			return fmt.Errorf("double %g does not fit in 32 bits", v)
+		}
+
+		n, _ := intToUint32(int64(thousandths))
+
+		value.Write(intToBytesBE(n))
+	case TypeStruct:
+		items, ok := record.Value.([]StructItem)
+
+		if !ok && record.Value != nil {
+			return errors.New("type error: expected type []StructItem")
+		}
+
+		// a struct is written as a start marker, avp names followed by their values, and an end marker
+		var buffer bytes.Buffer
+
+		buffer.WriteByte(TypeStruct)
+
+		for _, item := range items {
+			name := Record{Type: TypeAVP, Value: item.Key}
+
+			if err := name.Encode(&buffer); err != nil {
+				return err
+			}
+			if err := item.Value.Encode(&buffer); err != nil {
+				return err
+			}
+		}
+
+		buffer.WriteByte(1<<7 | TypeStruct)
+
+		_, err := buffer.WriteTo(w)
+		return err
+	case TypeArray:
+		// an array is written as a start marker, its items, and an end marker
+		var buffer bytes.Buffer
+
+		buffer.WriteByte(TypeArray)
+
+		switch items := record.Value.(type) {
+		case nil:
+			// no items
+		case []Record:
+			for _, item := range items {
+				if err := item.Encode(&buffer); err != nil {
+					return err
+				}
+			}
+		case encodedItems:
+			buffer.Write(items)
+		default:
+			return errors.New("type error: expected type []Record")
+		}
+
+		buffer.WriteByte(1<<7 | TypeArray)
+
+		_, err := buffer.WriteTo(w)
+		return err
 	default:
-		return fmt.Errorf("type error: type %d not implemented", record.Type)
+		opaque, ok := record.Value.(OpaqueValue)
+
+		if !ok || record.Type > 0x0F {
+			return fmt.Errorf("type error: type %s (%d) not implemented", TypeName(record.Type), record.Type)
+		}
+
+		// the raw value of a type not implemented, decoded by a Decoder with Opaque set
+		value.Write(opaque)
 	}
 
 	sizeOfValue := value.Len()
@@ -173,7 +781,11 @@ func (record *Record) Encode(w io.Writer) error {
 		buffer.WriteByte(header)
 		buffer.Write(value.Bytes())
 	} else {
-		sizeBytes := intToBytesBE(sizeOfValue)
+		sizeBytes, err := sizeToBytesBE(sizeOfValue)
+
+		if err != nil {
+			return fmt.Errorf("record too big: %w", err)
+		}
 
 		header := 1<<7 | uint8(len(sizeBytes)<<4) | record.Type
 
@@ -0,0 +1,660 @@
+package binrpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestToGo(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "int", Value: Record{Type: TypeInt, Value: 1}},
+		{Key: "string", Value: Record{Type: TypeString, Value: "s"}},
+		{Key: "double", Value: Record{Type: TypeDouble, Value: 1.5}},
+		{Key: "array", Value: Record{Type: TypeArray, Value: []Record{
+			{Type: TypeInt, Value: 2},
+			{Type: TypeStruct, Value: []StructItem{
+				{Key: "nested", Value: Record{Type: TypeString, Value: "n"}},
+			}},
+		}}},
+		{Key: "repeated", Value: Record{Type: TypeInt, Value: 1}},
+		{Key: "repeated", Value: Record{Type: TypeInt, Value: 2}},
+		{Key: "repeated", Value: Record{Type: TypeInt, Value: 3}},
+		{Key: "bytes", Value: Record{Type: TypeBytes, Value: []byte{0x01}}},
+		{Key: "invalid", Value: Record{Type: TypeArray, Value: "not an array"}},
+	}}
+
+	expected := map[string]any{
+		"int":    1,
+		"string": "s",
+		"double": 1.5,
+		"array": []any{
+			2,
+			map[string]any{"nested": "n"},
+		},
+		"repeated": []any{1, 2, 3},
+		"bytes":    "<type 6>",
+		"invalid":  "<type 4>",
+	}
+
+	if value := record.ToGo(); !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v, got %v", expected, value)
+	}
+}
+
+func TestToGoScalars(t *testing.T) {
+	for _, record := range []Record{NewInt(42), NewString("s"), NewDouble(0.5)} {
+		if value := record.ToGo(); value != record.Value {
+			t.Errorf("expected %v, got %v", record.Value, value)
+		}
+	}
+
+	if value := (Record{Type: TypeArray, Value: []Record{}}).ToGo(); !reflect.DeepEqual(value, []any{}) {
+		t.Errorf("expected an empty array, got %v", value)
+	}
+
+	// a struct or an array without value has no items
+	if value := (Record{Type: TypeStruct}).ToGo(); !reflect.DeepEqual(value, map[string]any{}) {
+		t.Errorf("expected an empty struct, got %v", value)
+	}
+	if value := (Record{Type: TypeArray}).ToGo(); !reflect.DeepEqual(value, []any{}) {
+		t.Errorf("expected an empty array, got %v", value)
+	}
+}
+
+func TestAccessorsOr(t *testing.T) {
+	if s := NewString("x").StringOr("def"); s != "x" {
+		t.Errorf(`expected "x", got "%s"`, s)
+	}
+	if n := NewInt(42).IntOr(-1); n != 42 {
+		t.Errorf("expected 42, got %d", n)
+	}
+	if f := NewDouble(1.5).DoubleOr(-1); f != 1.5 {
+		t.Errorf("expected 1.5, got %f", f)
+	}
+
+	// type mismatches return the default, like a record with a value not matching its type
+	for _, record := range []Record{NewInt(1), {Type: TypeStruct}, {Type: TypeString, Value: 1}} {
+		if s := record.StringOr("def"); s != "def" {
+			t.Errorf(`%v: expected "def", got "%s"`, record, s)
+		}
+	}
+	for _, record := range []Record{NewString("1"), NewDouble(1), {Type: TypeInt, Value: "1"}} {
+		if n := record.IntOr(-1); n != -1 {
+			t.Errorf("%v: expected -1, got %d", record, n)
+		}
+	}
+	for _, record := range []Record{NewInt(1), NewString("1.5"), {}} {
+		if f := record.DoubleOr(-1); f != -1 {
+			t.Errorf("%v: expected -1, got %f", record, f)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	constructed := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "name", Value: NewString("main")},
+		{Key: "count", Value: NewInt(3)},
+		{Key: "load", Value: NewDouble(0.25)},
+		{Key: "items", Value: Record{Type: TypeArray, Value: []Record{NewInt(1), NewInt(2)}}},
+		{Key: "empty", Value: Record{Type: TypeArray, Value: []Record{}}},
+	}}
+
+	var buffer bytes.Buffer
+
+	if err := constructed.Encode(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := ReadRecord(&buffer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.DeepEqual(*decoded, constructed) {
+		t.Error("decoded and constructed records are expected to differ for reflect.DeepEqual")
+	}
+	if !decoded.Equal(constructed) || !constructed.Equal(*decoded) {
+		t.Error("decoded and constructed records must be equal")
+	}
+
+	for _, other := range []Record{
+		NewString("main"),
+		{Type: TypeStruct, Value: []StructItem{}},
+		{Type: TypeStruct, Value: []StructItem{
+			{Key: "name", Value: NewString("main")},
+			{Key: "count", Value: NewInt(4)},
+			{Key: "load", Value: NewDouble(0.25)},
+			{Key: "items", Value: Record{Type: TypeArray, Value: []Record{NewInt(1), NewInt(2)}}},
+			{Key: "empty", Value: Record{Type: TypeArray, Value: []Record{}}},
+		}},
+		{Type: TypeStruct, Value: []StructItem{
+			{Key: "name", Value: NewString("main")},
+			{Key: "count", Value: NewInt(3)},
+			{Key: "load", Value: NewDouble(0.25)},
+			{Key: "items", Value: Record{Type: TypeArray, Value: []Record{NewInt(2), NewInt(1)}}},
+			{Key: "empty", Value: Record{Type: TypeArray, Value: []Record{}}},
+		}},
+	} {
+		if decoded.Equal(other) {
+			t.Errorf("records must differ: %v", other)
+		}
+	}
+
+	// an empty struct or array equals a nil one, both ways
+	for _, pair := range [][2]Record{
+		{{Type: TypeStruct}, {Type: TypeStruct, Value: []StructItem{}}},
+		{{Type: TypeArray}, {Type: TypeArray, Value: []Record{}}},
+	} {
+		if !pair[0].Equal(pair[1]) || !pair[1].Equal(pair[0]) || !pair[0].Equal(pair[0]) {
+			t.Errorf("expected %v to equal %v", pair[0], pair[1])
+		}
+	}
+
+	if (Record{Type: TypeArray}).Equal(Record{Type: TypeArray, Value: []Record{NewInt(1)}}) {
+		t.Error("a nil array must differ from an array with items")
+	}
+
+	if NewInt(1).Equal(NewString("1")) || NewInt(1).Equal(NewBool(false)) {
+		t.Error("scalars must differ")
+	}
+}
+
+func TestAppendStructItems(t *testing.T) {
+	var dec Decoder
+
+	// a struct {"a": 1, "b": "x"} in a reply
+	packet, _ := hex.DecodeString("a1100d0103256100100125620021780083")
+	dst := make([]StructItem, 0, 4)
+
+	for i := 0; i < 3; i++ {
+		dec.Reset(bytes.NewReader(packet))
+
+		records, err := dec.ReadPacket(0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items, err := records[0].AppendStructItems(dst[:0])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if &items[0] != &dst[:1][0] {
+			t.Error("expected the capacity of dst to be reused")
+		}
+		if len(items) != 2 || items[0].Key != "a" || items[1].Key != "b" {
+			t.Fatalf("unexpected items %v", items)
+		}
+
+		// the items do not share the slice of the record
+		items[0].Key = "changed"
+
+		if original, _ := records[0].StructItems(); original[0].Key != "a" {
+			t.Error("expected the items of the record to be unchanged")
+		}
+	}
+
+	// the values stay valid after the decoder reuses its payload buffer for another packet
+	dec.Reset(bytes.NewReader(packet))
+	records, _ := dec.ReadPacket(0)
+	items, _ := records[0].AppendStructItems(nil)
+
+	dec.Reset(bytes.NewReader(bytes.Replace(packet, []byte("x"), []byte("y"), 1)))
+
+	if _, err := dec.ReadPacket(0); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := items[1].Value.String(); s != "x" {
+		t.Errorf(`expected "x", got "%s"`, s)
+	}
+
+	if _, err := (&Record{Type: TypeInt, Value: 1}).AppendStructItems(dst); err == nil {
+		t.Error("expected an error for an int")
+	}
+}
+
+func TestStructItemsOrder(t *testing.T) {
+	// keys out of alphabetical order, with a repeated key, in a struct nested in a struct
+	keys := []string{"zeta", "alpha", "mu", "alpha", "beta"}
+	items := []StructItem{}
+
+	for i, key := range keys {
+		items = append(items, StructItem{Key: key, Value: NewInt(i)})
+	}
+
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "outer", Value: Record{Type: TypeStruct, Value: items}},
+		{Key: "after", Value: NewString("x")},
+	}}
+
+	var buffer bytes.Buffer
+
+	if err := writePacket(&buffer, 1, PacketReply, []Record{record}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadPacket(&buffer, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer, _ := records[0].StructItems()
+
+	if len(outer) != 2 || outer[0].Key != "outer" || outer[1].Key != "after" {
+		t.Fatalf("unexpected items %v", outer)
+	}
+
+	decoded, _ := outer[0].Value.StructItems()
+
+	if len(decoded) != len(keys) {
+		t.Fatalf("expected %d items, got %d", len(keys), len(decoded))
+	}
+
+	for i, item := range decoded {
+		if n, _ := item.Value.Int(); item.Key != keys[i] || n != i {
+			t.Errorf("item %d: expected %s = %d, got %s = %d", i, keys[i], i, item.Key, n)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "SET", Value: NewInt(1)},
+		{Key: "ID", Value: NewInt(2)},
+		{Key: "SET", Value: NewInt(3)},
+	}}
+
+	keys, err := record.Keys()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"SET", "ID", "SET"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	empty := Record{Type: TypeStruct, Value: []StructItem{}}
+
+	if keys, err := empty.Keys(); err != nil || keys == nil || len(keys) != 0 {
+		t.Errorf("expected no keys, got %v %v", keys, err)
+	}
+
+	array := Record{Type: TypeArray, Value: []Record{}}
+
+	if _, err := array.Keys(); err == nil {
+		t.Error("expected an error for an array")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []Record{
+		NewInt(1),
+		NewString("s"),
+		NewDouble(1.5),
+		{Type: TypeAVP, Value: "key"},
+		{Type: TypeStruct},
+		{Type: TypeArray},
+		{Type: TypeStruct, Value: []StructItem{{Key: "a", Value: NewInt(1)}}},
+		{Type: TypeArray, Value: []Record{NewString("x")}},
+	}
+
+	builder := ArrayBuilder{}
+	builder.Add(NewInt(1))
+	valid = append(valid, builder.Record())
+
+	for _, record := range valid {
+		if err := record.Validate(); err != nil {
+			t.Errorf("%v: %v", record, err)
+		}
+	}
+
+	invalid := []struct {
+		record   Record
+		expected string
+	}{
+		{Record{Type: TypeInt, Value: "1"}, "type error: expected type int (0) value, got string"},
+		{Record{Type: TypeInt}, "type error: expected type int (0) value, got <nil>"},
+		{Record{Type: TypeString, Value: 1}, "type error: expected type string (1) value, got int"},
+		{Record{Type: TypeAVP, Value: 1.5}, "type error: expected type string (5) value, got float64"},
+		{Record{Type: TypeDouble, Value: 1}, "type error: expected type double (2) value, got int"},
+		{Record{Type: TypeStruct, Value: []Record{}}, "type error: expected type struct (3) value, got []binrpc.Record"},
+		{Record{Type: TypeArray, Value: []StructItem{}}, "type error: expected type array (4) value, got []binrpc.StructItem"},
+		{Record{Type: TypeBytes, Value: []byte{}}, "type error: type bytes (6) not implemented"},
+		{
+			Record{Type: TypeStruct, Value: []StructItem{{Key: "a", Value: Record{Type: TypeInt, Value: "1"}}}},
+			"a: type error: expected type int (0) value, got string",
+		},
+		{
+			Record{Type: TypeArray, Value: []Record{NewInt(1), {Type: TypeString, Value: 2}}},
+			"item 1: type error: expected type string (1) value, got int",
+		},
+	}
+
+	for _, test := range invalid {
+		if err := test.record.Validate(); err == nil || err.Error() != test.expected {
+			t.Errorf("expected %q, got %v", test.expected, err)
+		}
+	}
+
+	if _, err := Args(Record{Type: TypeInt, Value: "1"}); err == nil {
+		t.Error("expected Args to validate records")
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	inner := Record{Type: TypeStruct, Value: []StructItem{{Key: "a", Value: NewInt(1)}}}
+
+	if unwrapped := (Record{Type: TypeArray, Value: []Record{inner}}).Unwrap(); !unwrapped.Equal(inner) {
+		t.Errorf("expected %v, got %v", inner, unwrapped)
+	}
+
+	// records other than arrays with one item are unchanged
+	for _, record := range []Record{
+		inner,
+		NewInt(1),
+		{Type: TypeArray, Value: []Record{}},
+		{Type: TypeArray, Value: []Record{inner, inner}},
+	} {
+		if unwrapped := record.Unwrap(); !unwrapped.Equal(record) {
+			t.Errorf("expected %v, got %v", record, unwrapped)
+		}
+	}
+}
+
+func TestEmptyStructAndArray(t *testing.T) {
+	structRecord, err := ReadRecord(bytes.NewReader([]byte{0x03, 0x83}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrayRecord, err := ReadRecord(bytes.NewReader([]byte{0x04, 0x84}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if structRecord.Type != TypeStruct || arrayRecord.Type != TypeArray {
+		t.Fatalf("unexpected types %d and %d", structRecord.Type, arrayRecord.Type)
+	}
+
+	// decoded, or built without items
+	for _, record := range []Record{*structRecord, {Type: TypeStruct}} {
+		if items, err := record.StructItems(); err != nil || items == nil || len(items) != 0 {
+			t.Errorf("expected empty items, got %#v, %v", items, err)
+		}
+
+		var items []StructItem
+
+		if err := record.Scan(&items); err != nil || items == nil || len(items) != 0 {
+			t.Errorf("expected empty items, got %#v, %v", items, err)
+		}
+
+		var m map[string]int
+
+		if err := record.Scan(&m); err != nil || m == nil || len(m) != 0 {
+			t.Errorf("expected an empty map, got %#v, %v", m, err)
+		}
+	}
+
+	for _, record := range []Record{*arrayRecord, {Type: TypeArray}} {
+		if items, err := record.Array(); err != nil || items == nil || len(items) != 0 {
+			t.Errorf("expected empty items, got %#v, %v", items, err)
+		}
+
+		var records []Record
+
+		if err := record.Scan(&records); err != nil || records == nil || len(records) != 0 {
+			t.Errorf("expected empty records, got %#v, %v", records, err)
+		}
+
+		var ints []int
+
+		if err := record.Scan(&ints); err != nil || ints == nil || len(ints) != 0 {
+			t.Errorf("expected an empty slice, got %#v, %v", ints, err)
+		}
+	}
+
+	// the two empty records are distinct
+	if _, err := structRecord.Array(); err == nil {
+		t.Error("expected an error for the array of a struct")
+	}
+	if _, err := arrayRecord.StructItems(); err == nil {
+		t.Error("expected an error for the items of an array")
+	}
+}
+
+func TestAsKeyValue(t *testing.T) {
+	pair := func(name string, value Record) Record {
+		return NewStruct(StructItem{Key: "name", Value: NewString(name)}, StructItem{Key: "value", Value: value})
+	}
+
+	expected := map[string]string{"abc": "1", "def": "sip:alice@example.com", "ghi": "0.500"}
+
+	for name, records := range map[string][]Record{
+		"pairs": {{Type: TypeArray, Value: []Record{
+			pair("abc", NewInt(1)),
+			pair("def", NewString("sip:alice@example.com")),
+			pair("ghi", NewDouble(0.5)),
+		}}},
+		"strings": {{Type: TypeArray, Value: []Record{
+			NewString("abc 1"),
+			NewString("def sip:alice@example.com"),
+			NewString("ghi = 0.500"),
+		}}},
+		"top level strings": {NewString("abc 1"), NewString("def sip:alice@example.com"), NewString("ghi 0.500")},
+		"struct": {NewStruct(
+			StructItem{Key: "abc", Value: NewInt(1)},
+			StructItem{Key: "def", Value: NewString("sip:alice@example.com")},
+			StructItem{Key: "ghi", Value: NewDouble(0.5)},
+		)},
+	} {
+		kv, err := AsKeyValue(records)
+
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(kv, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, kv)
+		}
+	}
+
+	// "=" in a value is not a separator
+	kv, err := AsKeyValue([]Record{
+		NewString("uri sip:alice@example.com;transport=tcp"),
+		NewString("mode=active"),
+		NewString("a b = c=d"),
+	})
+	expected = map[string]string{"uri": "sip:alice@example.com;transport=tcp", "mode": "active", "a b": "c=d"}
+
+	if err != nil || !reflect.DeepEqual(kv, expected) {
+		t.Errorf("expected %v, got %v %v", expected, kv, err)
+	}
+
+	for _, records := range [][]Record{
+		{NewInt(1)},
+		{NewString("abc")},
+		{NewStruct(StructItem{Key: "abc", Value: NewStruct()})},
+	} {
+		if _, err := AsKeyValue(records); err == nil {
+			t.Errorf("%v: expected an error", records)
+		}
+	}
+}
+
+func TestToGoNumber(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "counter", Value: NewInt(2147483647)},
+		{Key: "ratio", Value: NewDouble(0.5)},
+		{Key: "values", Value: Record{Type: TypeArray, Value: []Record{NewInt(1)}}},
+	}}
+
+	value := record.ToGoNumber().(map[string]any)
+
+	if value["counter"] != json.Number("2147483647") || value["ratio"] != 0.5 {
+		t.Errorf("unexpected value %v", value)
+	}
+	if values := value["values"].([]any); values[0] != json.Number("1") {
+		t.Errorf("expected json.Number in arrays, got %T", values[0])
+	}
+
+	// ToGo keeps ints as int
+	if counter := record.ToGo().(map[string]any)["counter"]; counter != 2147483647 {
+		t.Errorf("expected int, got %T", counter)
+	}
+
+	// the int survives a round trip through JSON
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var decoded map[string]any
+
+	if err := dec.Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := decoded["counter"].(json.Number).Int64(); err != nil || n != 2147483647 {
+		t.Errorf("expected 2147483647, got %v", decoded["counter"])
+	}
+}
+
+func TestNestedArrays(t *testing.T) {
+	point := func(x, y int) Record {
+		return Record{Type: TypeStruct, Value: []StructItem{{Key: "x", Value: NewInt(x)}, {Key: "y", Value: NewInt(y)}}}
+	}
+
+	// an array of arrays of structs, with an empty array and a struct holding an array of arrays
+	record := Record{Type: TypeArray, Value: []Record{
+		{Type: TypeArray, Value: []Record{point(1, 2), point(3, 4)}},
+		{Type: TypeArray, Value: []Record{}},
+		{Type: TypeArray, Value: []Record{
+			{Type: TypeStruct, Value: []StructItem{
+				{Key: "grid", Value: Record{Type: TypeArray, Value: []Record{
+					{Type: TypeArray, Value: []Record{NewInt(5), NewString("six")}},
+				}}},
+			}},
+		}},
+	}}
+
+	var buffer bytes.Buffer
+
+	if err := writePacket(&buffer, 1, PacketReply, []Record{record}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadPacket(&buffer, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].Equal(record) {
+		t.Fatalf("expected %v, got %v", record, records)
+	}
+
+	expected := []any{
+		[]any{map[string]any{"x": 1, "y": 2}, map[string]any{"x": 3, "y": 4}},
+		[]any{},
+		[]any{map[string]any{"grid": []any{[]any{5, "six"}}}},
+	}
+
+	if value := records[0].ToGo(); !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v, got %v", expected, value)
+	}
+
+	// the same shape is built from Go values by Args
+	args, err := Args(expected)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !args[0].Equal(record) {
+		t.Errorf("expected %v, got %v", record, args[0])
+	}
+
+	// and scanned into Go types
+	var points [][]struct {
+		X int `binrpc:"x"`
+		Y int `binrpc:"y"`
+	}
+
+	sub := Record{Type: TypeArray, Value: record.Value.([]Record)[:2]}
+
+	if err := sub.Scan(&points); err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || len(points[0]) != 2 || points[0][1].X != 3 || len(points[1]) != 0 {
+		t.Errorf("unexpected points %+v", points)
+	}
+}
+
+func TestScanBase64(t *testing.T) {
+	record := NewString("AAH/YmxvYg==")
+
+	var data []byte
+
+	if err := record.ScanBase64(&data); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0x00, 0x01, 0xff, 'b', 'l', 'o', 'b'}; !bytes.Equal(data, expected) {
+		t.Errorf("expected %x, got %x", expected, data)
+	}
+
+	empty := NewString("")
+
+	if err := empty.ScanBase64(&data); err != nil || len(data) != 0 {
+		t.Errorf("expected no bytes, got %x %v", data, err)
+	}
+
+	for _, record := range []Record{NewString("not base64!"), NewString("AAH/YmxvYg"), NewInt(1)} {
+		data = []byte("unchanged")
+
+		if err := record.ScanBase64(&data); err == nil {
+			t.Errorf("%v: expected an error", record.Value)
+		}
+		if string(data) != "unchanged" {
+			t.Errorf("%v: expected dest to be unchanged, got %q", record.Value, data)
+		}
+	}
+}
+
+func TestScanBigInt(t *testing.T) {
+	record := NewString("123456789012345678901234567890")
+
+	n := new(big.Int)
+
+	if err := record.ScanBigInt(n); err != nil {
+		t.Fatal(err)
+	}
+	if n.String() != "123456789012345678901234567890" || n.IsInt64() {
+		t.Errorf("expected a number larger than int64, got %s", n)
+	}
+
+	small := NewInt(-42)
+
+	if err := small.ScanBigInt(n); err != nil || n.Int64() != -42 {
+		t.Errorf("expected -42, got %s %v", n, err)
+	}
+
+	for _, record := range []Record{NewString("12a"), NewString(""), NewString("1.5"), NewDouble(1)} {
+		n.SetInt64(7)
+
+		if err := record.ScanBigInt(n); err == nil {
+			t.Errorf("%v: expected an error", record.Value)
+		}
+		if n.Int64() != 7 {
+			t.Errorf("%v: expected dest to be unchanged, got %s", record.Value, n)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reload calls a reload-style method with args, like "dispatcher.reload". These methods return nothing or a status
+// that is ignored, and a fault when the reload failed, returned as an *RPCError.
+func Reload(conn io.ReadWriter, method string, args ...Record) error {
+	_, err := Call(conn, method, args...)
+
+	return err
+}
+
+// HTableReload calls "htable.reload" to reload table from the database.
+func HTableReload(conn io.ReadWriter, table string) error {
+	return Reload(conn, "htable.reload", NewString(table))
+}
+
+// DispatcherReload calls "dispatcher.reload" to reload the destinations from the database or the list file.
+func DispatcherReload(conn io.ReadWriter) error {
+	return Reload(conn, "dispatcher.reload")
+}
+
+// CfgChange is a change of a variable of the cfg framework, as listed by "cfg.diff", like the "debug" variable of the
+// "core" group set from "2" to "3". GroupID is set for a change of an additional instance of the group, like 1 for
+// "tm[1]". Int values are formatted as decimal strings.
+type CfgChange struct {
+	Group   string `binrpc:"group name"`
+	GroupID *int   `binrpc:"group id"`
+	Name    string `binrpc:"variable name"`
+	Old     string `binrpc:"old value"`
+	New     string `binrpc:"new value"`
+}
+
+// CfgCommitResult is the result of CfgCommit. Detailed is false when the version of Kamailio cannot list the changes:
+// the commit succeeded, but Changes is empty.
+type CfgCommitResult struct {
+	Changes  []CfgChange
+	Detailed bool
+}
+
+// CfgCommit commits the changes of the cfg framework set with the "cfg.set_delayed" methods, and returns them: they
+// are listed with "cfg.diff" before calling "cfg.commit". A commit refused by Kamailio is returned as an *RPCError.
+func CfgCommit(conn io.ReadWriter) (CfgCommitResult, error) {
+	result := CfgCommitResult{Changes: []CfgChange{}, Detailed: true}
+
+	records, err := Call(conn, "cfg.diff")
+
+	if errors.Is(err, ErrMethodNotFound) {
+		result.Detailed = false
+	} else if err != nil {
+		return CfgCommitResult{}, err
+	}
+
+	// each change is a struct with the keys "group name", "group id" for an additional instance, "variable name",
+	// "old value" and "new value"
+	for i := range records {
+		var change CfgChange
+
+		if err := records[i].Scan(&change); err != nil {
+			return CfgCommitResult{}, fmt.Errorf("invalid change: %w", err)
+		}
+
+		result.Changes = append(result.Changes, change)
+	}
+
+	if _, err := Call(conn, "cfg.commit"); err != nil {
+		return CfgCommitResult{}, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package binrpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	var methods []string
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+		methods = append(methods, method)
+
+		if method == "htable.reload" {
+			if table, _ := request[1].String(); table != "ipban" {
+				return fault(500, "no such htable")
+			}
+
+			// a status instead of an empty response
+			return PacketReply, []Record{NewString("Ok")}
+		}
+
+		return PacketReply, nil
+	})
+
+	if err := DispatcherReload(conn); err != nil {
+		t.Error(err)
+	}
+	if err := HTableReload(conn, "ipban"); err != nil {
+		t.Error(err)
+	}
+	if err := DialplanReload(conn); err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"dispatcher.reload", "htable.reload", "dialplan.reload"}
+
+	for i := range expected {
+		if i >= len(methods) || methods[i] != expected[i] {
+			t.Errorf("expected methods %v, got %v", expected, methods)
+			break
+		}
+	}
+}
+
+func TestReloadFault(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return fault(500, "Reload failed")
+	})
+
+	err := DispatcherReload(conn)
+
+	var rpcErr *RPCError
+
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "Reload failed" {
+		t.Errorf("expected an RPCError, got %v", err)
+	}
+}
+
+func TestCfgCommit(t *testing.T) {
+	var methods []string
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+		methods = append(methods, method)
+
+		if method == "cfg.diff" {
+			return PacketReply, []Record{
+				NewStruct(
+					StructItem{Key: "group name", Value: NewString("core")},
+					StructItem{Key: "variable name", Value: NewString("debug")},
+					StructItem{Key: "old value", Value: NewInt(2)},
+					StructItem{Key: "new value", Value: NewInt(3)},
+				),
+				NewStruct(
+					StructItem{Key: "group name", Value: NewString("tm")},
+					StructItem{Key: "group id", Value: NewInt(1)},
+					StructItem{Key: "variable name", Value: NewString("fr_timer")},
+					StructItem{Key: "old value", Value: NewInt(3000)},
+					StructItem{Key: "new value", Value: NewInt(4000)},
+				),
+				NewStruct(
+					StructItem{Key: "group name", Value: NewString("core")},
+					StructItem{Key: "variable name", Value: NewString("server_header")},
+					StructItem{Key: "old value", Value: NewString("Server: kamailio")},
+					StructItem{Key: "new value", Value: NewString("Server: edge")},
+				),
+			}
+		}
+
+		return PacketReply, nil
+	})
+
+	result, err := CfgCommit(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := 1
+	expected := []CfgChange{
+		{Group: "core", Name: "debug", Old: "2", New: "3"},
+		{Group: "tm", GroupID: &id, Name: "fr_timer", Old: "3000", New: "4000"},
+		{Group: "core", Name: "server_header", Old: "Server: kamailio", New: "Server: edge"},
+	}
+
+	if !result.Detailed || !reflect.DeepEqual(result.Changes, expected) {
+		t.Errorf("expected %v, got %+v", expected, result)
+	}
+	if !reflect.DeepEqual(methods, []string{"cfg.diff", "cfg.commit"}) {
+		t.Errorf("unexpected methods %v", methods)
+	}
+
+	// without cfg.diff, the commit is not detailed
+	conn = serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "cfg.diff" {
+			return fault(500, "command cfg.diff not found")
+		}
+
+		return PacketReply, []Record{NewString("ok")}
+	})
+
+	if result, err := CfgCommit(conn); err != nil || result.Detailed || len(result.Changes) != 0 {
+		t.Errorf("expected a commit without details, got %+v %v", result, err)
+	}
+
+	// a refused commit
+	conn = serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "cfg.commit" {
+			return fault(500, "failed to commit the changes")
+		}
+
+		return PacketReply, nil
+	})
+
+	var rpcErr *RPCError
+
+	if _, err := CfgCommit(conn); !errors.As(err, &rpcErr) {
+		t.Errorf("expected an *RPCError, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RTPEngineNode is the result of the ping of an rtpengine node by the rtpengine module.
+// Reachable reports whether the node answered, and Latency is the duration of the ping through Kamailio. Err is the
+// fault or the failed status of this node, if any.
+type RTPEngineNode struct {
+	URL       string
+	Set       int
+	Reachable bool
+	Latency   time.Duration
+	Err       error
+}
+
+// rtpEngineShowNode is a node as returned by "rtpengine.show".
+type rtpEngineShowNode struct {
+	URL string `binrpc:"url"`
+	Set int    `binrpc:"set"`
+}
+
+// RTPEnginePing lists the nodes with "rtpengine.show", and pings each of them with "rtpengine.ping".
+// A node that cannot be pinged is returned with Reachable false and its fault in Err. Other errors, like the failure
+// of the connection, are returned as an error: the nodes left cannot be pinged.
+func RTPEnginePing(conn io.ReadWriter) ([]RTPEngineNode, error) {
+	records, err := Call(conn, "rtpengine.show", NewString("all"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []RTPEngineNode{}
+
+	for _, record := range records {
+		// each node is a top level struct, but accept them wrapped in an array
+		items := []Record{record}
+
+		if record.Type == TypeArray {
+			if items, err = record.Array(); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, item := range items {
+			show := rtpEngineShowNode{}
+
+			if err := item.Scan(&show); err != nil {
+				return nil, err
+			}
+
+			node := RTPEngineNode{URL: show.URL, Set: show.Set}
+
+			start := time.Now()
+			node.Err, err = rtpEnginePingNode(conn, show.URL)
+			node.Latency = time.Since(start)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Reachable = node.Err == nil
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// rtpEnginePingNode pings the node at url. The first error is the failure of this node, a fault or a status other
+// than "success", and the connection is usable for the next node. The second error is any other failure of the call.
+func rtpEnginePingNode(conn io.ReadWriter, url string) (nodeErr, err error) {
+	var result struct {
+		Status string `binrpc:"status"`
+	}
+
+	err = callStruct(conn, &result, "rtpengine.ping", NewString(url))
+
+	var rpcErr *RPCError
+
+	if errors.As(err, &rpcErr) {
+		return err, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if result.Status != "success" {
+		return fmt.Errorf("ping %s: %s", url, result.Status), nil
+	}
+
+	return nil, nil
+}
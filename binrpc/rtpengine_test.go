@@ -0,0 +1,100 @@
+package binrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func rtpEngineNode(url string, disabled int) Record {
+	return Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "url", Value: NewString(url)},
+		{Key: "set", Value: NewInt(0)},
+		{Key: "index", Value: NewInt(0)},
+		{Key: "weight", Value: NewInt(1)},
+		{Key: "disabled", Value: NewInt(disabled)},
+		{Key: "recheck_ticks", Value: NewInt(0)},
+	}}
+}
+
+func TestRTPEnginePing(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		method, _ := request[0].String()
+		url, _ := request[1].String()
+
+		if method == "rtpengine.show" {
+			return PacketReply, []Record{
+				rtpEngineNode("udp:10.0.0.1:2223", 0),
+				rtpEngineNode("udp:10.0.0.2:2223", 1),
+				rtpEngineNode("udp:10.0.0.3:2223", 0),
+			}
+		}
+
+		switch url {
+		case "udp:10.0.0.1:2223":
+			return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{
+				{Key: "url", Value: NewString(url)},
+				{Key: "status", Value: NewString("success")},
+			}}}
+		case "udp:10.0.0.2:2223":
+			return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{
+				{Key: "url", Value: NewString(url)},
+				{Key: "status", Value: NewString("fail")},
+			}}}
+		}
+
+		return fault(404, "Instance not found")
+	})
+
+	nodes, err := RTPEnginePing(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(nodes))
+	}
+
+	if nodes[0].URL != "udp:10.0.0.1:2223" || !nodes[0].Reachable || nodes[0].Err != nil {
+		t.Errorf("unexpected node %+v", nodes[0])
+	}
+	if nodes[1].Reachable || nodes[1].Err == nil {
+		t.Errorf("expected node %s to fail, got %+v", nodes[1].URL, nodes[1])
+	}
+
+	var rpcErr *RPCError
+
+	if nodes[2].Reachable || !errors.As(nodes[2].Err, &rpcErr) || rpcErr.Code != 404 {
+		t.Errorf("expected a fault for node %s, got %+v", nodes[2].URL, nodes[2])
+	}
+}
+
+// transportFunc is a Transport calling a function.
+type transportFunc func(ctx context.Context, method string, args []Record) ([]Record, error)
+
+func (fn transportFunc) RoundTrip(ctx context.Context, method string, args []Record) ([]Record, error) {
+	return fn(ctx, method, args)
+}
+
+func TestRTPEnginePingBroken(t *testing.T) {
+	pings := 0
+
+	conn := NewConn(transportFunc(func(ctx context.Context, method string, args []Record) ([]Record, error) {
+		if method == "rtpengine.show" {
+			return []Record{rtpEngineNode("udp:10.0.0.1:2223", 0), rtpEngineNode("udp:10.0.0.2:2223", 0)}, nil
+		}
+
+		pings++
+
+		return nil, io.ErrUnexpectedEOF
+	}))
+
+	// the failure of the connection is not the failure of a node
+	if nodes, err := RTPEnginePing(conn); !errors.Is(err, io.ErrUnexpectedEOF) || nodes != nil {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %+v %v", nodes, err)
+	}
+	if pings != 1 {
+		t.Errorf("expected the pings to stop on the broken connection, got %d pings", pings)
+	}
+}
@@ -0,0 +1,353 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	recordType      = reflect.TypeOf(Record{})
+	structItemsType = reflect.TypeOf([]StructItem{})
+	recordsType     = reflect.TypeOf([]Record{})
+)
+
+// scanReflect copies the value in the Record into dest, a pointer to a Go struct, slice, map or scalar, using reflection.
+func (record *Record) scanReflect(dest any) error {
+	v := reflect.ValueOf(dest)
+
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("invalid dest type: expected a non-nil pointer")
+	}
+
+	return record.scanValue(v.Elem())
+}
+
+// scanValue copies the value in the Record into v, which must be settable.
+func (record *Record) scanValue(v reflect.Value) error {
+	switch v.Type() {
+	case recordType:
+		v.Set(reflect.ValueOf(*record))
+		return nil
+	case structItemsType, recordsType:
+		return record.Scan(v.Addr().Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		var s string
+
+		if err := record.Scan(&s); err != nil {
+			return err
+		}
+
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int
+
+		if err := record.Scan(&i); err != nil {
+			return err
+		}
+
+		if v.OverflowInt(int64(i)) {
+			return fmt.Errorf("type error: %d overflows %s", i, v.Type())
+		}
+
+		v.SetInt(int64(i))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var i int
+
+		if err := record.Scan(&i); err != nil {
+			return err
+		}
+
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return fmt.Errorf("type error: %d overflows %s", i, v.Type())
+		}
+
+		v.SetUint(uint64(i))
+	case reflect.Bool:
+		var b bool
+
+		if err := record.Scan(&b); err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+
+		if err := record.Scan(&f); err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return record.scanValue(v.Elem())
+	case reflect.Slice:
+		items, err := record.Array()
+
+		if err != nil {
+			return err
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+
+		for i := range items {
+			if err := items[i].scanValue(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		v.Set(slice)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("type error: cannot convert %s (%d) to %s", TypeName(record.Type), record.Type, v.Type())
+		}
+
+		items, err := record.StructItems()
+
+		if err != nil {
+			return err
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(items)))
+		}
+
+		for _, item := range items {
+			elem := reflect.New(v.Type().Elem()).Elem()
+
+			if err := item.Value.scanValue(elem); err != nil {
+				return fmt.Errorf("%s: %w", item.Key, err)
+			}
+
+			v.SetMapIndex(reflect.ValueOf(item.Key).Convert(v.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		return record.scanStruct(v)
+	default:
+		return fmt.Errorf("type error: cannot convert %s (%d) to %s", TypeName(record.Type), record.Type, v.Type())
+	}
+
+	return nil
+}
+
+// scanStruct copies the items of a struct Record into the fields of v.
+//
+// Items are matched to fields by the name in the "binrpc" tag of the field, or by the name of the field
+// (case insensitive). A field with the tag `binrpc:"-"` is skipped. As BINRPC structs may contain the same key
+// multiple times, all the values of a repeated key are appended when the field is a slice. An int field, or a slice of
+// ints, with the option "unsigned", like `binrpc:"flags,unsigned"`, is decoded as uint32 values, see scanUnsigned.
+func (record *Record) scanStruct(v reflect.Value) error {
+	items, err := record.StructItems()
+
+	if err != nil {
+		return err
+	}
+
+	fields := structFields(v.Type())
+	appended := map[int]bool{}
+
+	for _, item := range items {
+		index, ok := fields.lookup(item.Key)
+
+		if !ok {
+			continue
+		}
+
+		field := v.Field(index)
+
+		if field.Kind() == reflect.Slice && field.Type() != structItemsType && field.Type() != recordsType && item.Value.Type != TypeArray {
+			// a repeated key, each value is an element of the slice
+			if !appended[index] {
+				field.Set(reflect.MakeSlice(field.Type(), 0, 1))
+				appended[index] = true
+			}
+
+			elem := reflect.New(field.Type().Elem()).Elem()
+			scan := item.Value.scanValue
+
+			if fields.unsigned(index) {
+				scan = item.Value.scanUnsigned
+			}
+
+			if err := scan(elem); err != nil {
+				return fmt.Errorf("%s: %w", item.Key, err)
+			}
+
+			field.Set(reflect.Append(field, elem))
+			continue
+		}
+
+		if fields.unsigned(index) {
+			if err := item.Value.scanUnsigned(field); err != nil {
+				return fmt.Errorf("%s: %w", item.Key, err)
+			}
+
+			continue
+		}
+
+		if err := item.Value.scanValue(field); err != nil {
+			return fmt.Errorf("%s: %w", item.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// scanUnsigned copies the int value in the Record into v, an int or uint, as an unsigned 32-bit int: a negative value
+// is the sign extension of a value with the high bit set, like a bitmask of flags. The items of an array Record are
+// copied the same way into v, a slice of ints or uints.
+func (record *Record) scanUnsigned(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return record.scanUnsigned(v.Elem())
+	case reflect.Slice:
+		items, err := record.Array()
+
+		if err != nil {
+			return err
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+
+		for i := range items {
+			if err := items[i].scanUnsigned(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		v.Set(slice)
+
+		return nil
+	}
+
+	u, err := record.uint32()
+
+	if err != nil {
+		return err
+	}
+
+	n := uint64(u)
+
+	switch {
+	case v.CanUint() && !v.OverflowUint(n):
+		v.SetUint(n)
+	case v.CanInt() && !v.OverflowInt(int64(n)):
+		v.SetInt(int64(n))
+	case v.CanUint() || v.CanInt():
+		return fmt.Errorf("type error: %d overflows %s", n, v.Type())
+	default:
+		return fmt.Errorf("type error: cannot decode unsigned into %s", v.Type())
+	}
+
+	return nil
+}
+
+// uint32 returns the int value, or the numeric string, as an unsigned 32-bit int, reverting the sign extension of a
+// negative value.
+func (record *Record) uint32() (uint32, error) {
+	var n int64
+
+	switch value := record.Value.(type) {
+	case int:
+		n = int64(value)
+	case string:
+		var err error
+
+		if n, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64); err != nil {
+			return 0, fmt.Errorf("type error: cannot convert string %q to int", value)
+		}
+	default:
+		return 0, fmt.Errorf("type error: cannot convert %s (%d) to int", TypeName(record.Type), record.Type)
+	}
+
+	if n < math.MinInt32 || n > math.MaxUint32 {
+		return 0, fmt.Errorf("type error: %d overflows uint32", n)
+	}
+
+	return uint32(n), nil
+}
+
+type structField struct {
+	name  string
+	index int
+	// unsigned is set by the "unsigned" option of the tag, for an int decoded as uint32
+	unsigned bool
+}
+
+type fieldList []structField
+
+// structFields returns the fields of struct type t that can be decoded.
+func structFields(t reflect.Type) fieldList {
+	fields := fieldList{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		unsigned := false
+
+		if tag, ok := f.Tag.Lookup("binrpc"); ok {
+			tagName, options, _ := strings.Cut(tag, ",")
+
+			if tagName == "-" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+
+			for _, option := range strings.Split(options, ",") {
+				unsigned = unsigned || option == "unsigned"
+			}
+		}
+
+		fields = append(fields, structField{name: name, index: i, unsigned: unsigned})
+	}
+
+	return fields
+}
+
+// unsigned reports whether the field at index has the "unsigned" option.
+func (fields fieldList) unsigned(index int) bool {
+	for _, f := range fields {
+		if f.index == index {
+			return f.unsigned
+		}
+	}
+
+	return false
+}
+
+// lookup returns the index of the field matching key, preferring an exact match over a case insensitive one.
+func (fields fieldList) lookup(key string) (int, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f.index, true
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f.index, true
+		}
+	}
+
+	return 0, false
+}
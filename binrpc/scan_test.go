@@ -0,0 +1,409 @@
+package binrpc
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestScanStructRepeatedKey(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "domain", Value: Record{Type: TypeString, Value: "example.com"}},
+		{Key: "alias", Value: Record{Type: TypeString, Value: "a.example.com"}},
+		{Key: "alias", Value: Record{Type: TypeString, Value: "b.example.com"}},
+		{Key: "port", Value: Record{Type: TypeInt, Value: 5060}},
+		{Key: "alias", Value: Record{Type: TypeString, Value: "c.example.com"}},
+	}}
+
+	var dest struct {
+		Domain  string
+		Aliases []string `binrpc:"alias"`
+		Port    uint16
+		Ignored string `binrpc:"-"`
+	}
+
+	dest.Aliases = []string{"stale"}
+
+	if err := record.Scan(&dest); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a.example.com", "b.example.com", "c.example.com"}
+
+	if !reflect.DeepEqual(dest.Aliases, expected) {
+		t.Errorf("expected %v, got %v", expected, dest.Aliases)
+	}
+	if dest.Domain != "example.com" || dest.Port != 5060 {
+		t.Errorf("unexpected value %+v", dest)
+	}
+}
+
+func TestScanNested(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "name", Value: Record{Type: TypeString, Value: "main"}},
+		{Key: "counters", Value: Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "in", Value: Record{Type: TypeInt, Value: 1}},
+			{Key: "out", Value: Record{Type: TypeInt, Value: 2}},
+		}}},
+		{Key: "loads", Value: Record{Type: TypeArray, Value: []Record{
+			{Type: TypeDouble, Value: 0.5},
+			{Type: TypeInt, Value: 1},
+		}}},
+		{Key: "raw", Value: Record{Type: TypeInt, Value: 7}},
+	}}
+
+	var dest struct {
+		Name     string
+		Counters map[string]int
+		Loads    []float64
+		Raw      *Record
+	}
+
+	if err := record.Scan(&dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if dest.Name != "main" {
+		t.Errorf(`expected "main", got "%s"`, dest.Name)
+	}
+	if !reflect.DeepEqual(dest.Counters, map[string]int{"in": 1, "out": 2}) {
+		t.Errorf("unexpected counters %v", dest.Counters)
+	}
+	if !reflect.DeepEqual(dest.Loads, []float64{0.5, 1}) {
+		t.Errorf("unexpected loads %v", dest.Loads)
+	}
+	if dest.Raw == nil || dest.Raw.Value != 7 {
+		t.Errorf("unexpected raw %v", dest.Raw)
+	}
+}
+
+func TestScanReflectErrors(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "port", Value: Record{Type: TypeInt, Value: 70000}},
+	}}
+
+	var dest struct {
+		Port uint16
+	}
+
+	if err := record.Scan(&dest); err == nil {
+		t.Error("expected an overflow error")
+	}
+	if err := record.Scan(dest); err == nil {
+		t.Error("expected an error for a non pointer dest")
+	}
+
+	var s []string
+
+	if err := record.Scan(&s); err == nil {
+		t.Error("expected an error scanning a struct into a slice")
+	}
+}
+
+type testDispatcherDest struct {
+	URI      string `binrpc:"URI"`
+	Flags    string `binrpc:"FLAGS"`
+	Priority int    `binrpc:"PRIORITY"`
+	Attrs    struct {
+		Weight int `binrpc:"WEIGHT"`
+	} `binrpc:"ATTRS"`
+}
+
+type testDispatcherSet struct {
+	ID      int `binrpc:"ID"`
+	Targets struct {
+		Dests []testDispatcherDest `binrpc:"DEST"`
+	} `binrpc:"TARGETS"`
+}
+
+type testDispatcherList struct {
+	NRSets  int `binrpc:"NRSETS"`
+	Records struct {
+		Sets []testDispatcherSet `binrpc:"SET"`
+	} `binrpc:"RECORDS"`
+}
+
+func testDispatcherDestRecord(uri, flags string, weight int) Record {
+	return Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "URI", Value: NewString(uri)},
+		{Key: "FLAGS", Value: NewString(flags)},
+		{Key: "PRIORITY", Value: NewInt(0)},
+		{Key: "ATTRS", Value: Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "BODY", Value: NewString("weight=" + strconv.Itoa(weight))},
+			{Key: "WEIGHT", Value: NewInt(weight)},
+		}}},
+	}}
+}
+
+func testDispatcherSetRecord(id int, dests ...Record) Record {
+	targets := []StructItem{}
+
+	for _, dest := range dests {
+		targets = append(targets, StructItem{Key: "DEST", Value: dest})
+	}
+
+	return Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "ID", Value: NewInt(id)},
+		{Key: "TARGETS", Value: Record{Type: TypeStruct, Value: targets}},
+	}}
+}
+
+func TestScanDispatcherList(t *testing.T) {
+	// dispatcher.list nests repeated SET keys, each with repeated DEST keys
+	response := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "NRSETS", Value: NewInt(2)},
+		{Key: "RECORDS", Value: Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "SET", Value: testDispatcherSetRecord(1,
+				testDispatcherDestRecord("sip:10.0.0.1:5060", "AP", 50),
+				testDispatcherDestRecord("sip:10.0.0.2:5060", "IP", 50),
+			)},
+			{Key: "SET", Value: testDispatcherSetRecord(2,
+				testDispatcherDestRecord("sip:10.0.1.1:5060", "AX", 100),
+			)},
+		}}},
+	}}
+
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{response}
+	})
+
+	records, err := Call(conn, "dispatcher.list")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list testDispatcherList
+
+	if err := records[0].Scan(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if list.NRSets != 2 || len(list.Records.Sets) != 2 {
+		t.Fatalf("unexpected list %+v", list)
+	}
+
+	set := list.Records.Sets[0]
+
+	if set.ID != 1 || len(set.Targets.Dests) != 2 {
+		t.Fatalf("unexpected set %+v", set)
+	}
+	if dest := set.Targets.Dests[1]; dest.URI != "sip:10.0.0.2:5060" || dest.Flags != "IP" || dest.Attrs.Weight != 50 {
+		t.Errorf("unexpected destination %+v", dest)
+	}
+	if dests := list.Records.Sets[1].Targets.Dests; len(dests) != 1 || dests[0].Attrs.Weight != 100 {
+		t.Errorf("unexpected destinations %+v", dests)
+	}
+}
+
+func TestScanArrayOfStructsField(t *testing.T) {
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "ID", Value: NewInt(1)},
+		{Key: "DESTS", Value: Record{Type: TypeArray, Value: []Record{
+			testDispatcherDestRecord("sip:10.0.0.1:5060", "AP", 10),
+			testDispatcherDestRecord("sip:10.0.0.2:5060", "DX", 20),
+		}}},
+	}}
+
+	var set struct {
+		ID    int
+		Dests []testDispatcherDest
+	}
+
+	if err := record.Scan(&set); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(set.Dests) != 2 || set.Dests[0].Attrs.Weight != 10 || set.Dests[1].Flags != "DX" {
+		t.Errorf("unexpected set %+v", set)
+	}
+}
+
+func TestScanBool(t *testing.T) {
+	tests := []struct {
+		record   Record
+		expected bool
+	}{
+		{NewInt(1), true},
+		{NewInt(0), false},
+		{NewInt(-1), true},
+		{NewString("true"), true},
+		{NewString("TRUE"), true},
+		{NewString("on"), true},
+		{NewString("On"), true},
+		{NewString("yes"), true},
+		{NewString("1"), true},
+		{NewString("false"), false},
+		{NewString("False"), false},
+		{NewString("off"), false},
+		{NewString("OFF"), false},
+		{NewString("no"), false},
+		{NewString("0"), false},
+	}
+
+	for _, test := range tests {
+		b := !test.expected
+
+		if err := test.record.Scan(&b); err != nil {
+			t.Errorf("%v: %v", test.record.Value, err)
+		} else if b != test.expected {
+			t.Errorf("%v: expected %t, got %t", test.record.Value, test.expected, b)
+		}
+	}
+
+	var b bool
+
+	for _, record := range []Record{NewString("enabled"), NewString(""), NewDouble(1)} {
+		if err := record.Scan(&b); err == nil {
+			t.Errorf("%v: expected an error", record.Value)
+		}
+	}
+
+	// bools are decoded in structs too
+	var status struct {
+		Active  bool `binrpc:"active"`
+		Enabled bool `binrpc:"enabled"`
+	}
+
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "active", Value: NewInt(1)},
+		{Key: "enabled", Value: NewString("on")},
+	}}
+
+	if err := record.Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Active || !status.Enabled {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestScanCoercion(t *testing.T) {
+	type dest struct {
+		ID     int     `binrpc:"id"`
+		Port   uint16  `binrpc:"port"`
+		Expiry int64   `binrpc:"expiry"`
+		Load   float64 `binrpc:"load"`
+		Name   string  `binrpc:"name"`
+		Flags  *int    `binrpc:"flags"`
+	}
+
+	// the same logical fields, as sent by two versions of a module
+	shapes := []Record{
+		{Type: TypeStruct, Value: []StructItem{
+			{Key: "id", Value: NewInt(7)},
+			{Key: "port", Value: NewInt(5060)},
+			{Key: "expiry", Value: NewInt(3600)},
+			{Key: "load", Value: NewInt(2)},
+			{Key: "name", Value: NewInt(42)},
+			{Key: "flags", Value: NewInt(3)},
+		}},
+		{Type: TypeStruct, Value: []StructItem{
+			{Key: "id", Value: NewString("7")},
+			{Key: "port", Value: NewString(" 5060 ")},
+			{Key: "expiry", Value: NewString("3600")},
+			{Key: "load", Value: NewString("2")},
+			{Key: "name", Value: NewString("42")},
+			{Key: "flags", Value: NewString("3")},
+		}},
+	}
+
+	for i, shape := range shapes {
+		var d dest
+
+		if err := shape.Scan(&d); err != nil {
+			t.Fatalf("shape %d: %v", i, err)
+		}
+
+		if d.ID != 7 || d.Port != 5060 || d.Expiry != 3600 || d.Load != 2 || d.Name != "42" || d.Flags == nil || *d.Flags != 3 {
+			t.Errorf("shape %d: unexpected %+v", i, d)
+		}
+	}
+
+	schema := NewSchema[dest]().
+		Int("id", func(d *dest) *int { return &d.ID }).
+		Double("load", func(d *dest) *float64 { return &d.Load }).
+		String("name", func(d *dest) *string { return &d.Name })
+
+	for i, shape := range shapes {
+		var d dest
+
+		if err := schema.Decode(shape, &d); err != nil {
+			t.Fatalf("shape %d: %v", i, err)
+		}
+
+		if d.ID != 7 || d.Load != 2 || d.Name != "42" {
+			t.Errorf("shape %d: unexpected %+v", i, d)
+		}
+	}
+
+	invalid := Record{Type: TypeStruct, Value: []StructItem{{Key: "port", Value: NewString("sip")}}}
+
+	var d dest
+
+	if err := invalid.Scan(&d); err == nil || err.Error() != `port: type error: cannot convert string "sip" to int` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestScanUnsigned(t *testing.T) {
+	var flags struct {
+		Flags    uint32 `binrpc:"flags,unsigned"`
+		Mask     int64  `binrpc:"mask,unsigned"`
+		Priority *uint  `binrpc:"priority,unsigned"`
+		Signed   int    `binrpc:"signed"`
+	}
+
+	// the high bit set, decoded as -2147483647 from the wire
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "flags", Value: NewInt(-2147483647)},
+		{Key: "mask", Value: NewInt(-1)},
+		{Key: "priority", Value: NewString("4294967295")},
+		{Key: "signed", Value: NewInt(-1)},
+	}}
+
+	if err := record.Scan(&flags); err != nil {
+		t.Fatal(err)
+	}
+
+	if flags.Flags != 0x80000001 || flags.Mask != 0xffffffff || flags.Priority == nil || *flags.Priority != 0xffffffff ||
+		flags.Signed != -1 {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+
+	var small struct {
+		Flags int32 `binrpc:"flags,unsigned"`
+	}
+
+	if err := record.Scan(&small); err == nil {
+		t.Error("expected an error for a uint32 overflowing an int32")
+	}
+
+	var bitmask uint32
+
+	schema := NewSchema[uint32]().Uint32("flags", func(dest *uint32) *uint32 { return dest })
+
+	if err := schema.Decode(record, &bitmask); err != nil || bitmask != 0x80000001 {
+		t.Errorf("expected 0x80000001, got %#x %v", bitmask, err)
+	}
+
+	// each value of a repeated key, or item of an array, is decoded as unsigned
+	var lists struct {
+		Flags []uint32 `binrpc:"flags,unsigned"`
+		Masks []int64  `binrpc:"masks,unsigned"`
+	}
+
+	record = Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "flags", Value: NewInt(-1)},
+		{Key: "flags", Value: NewInt(2)},
+		{Key: "masks", Value: Record{Type: TypeArray, Value: []Record{NewInt(-2147483648), NewInt(1)}}},
+	}}
+
+	if err := record.Scan(&lists); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(lists.Flags, []uint32{0xffffffff, 2}) || !reflect.DeepEqual(lists.Masks, []int64{0x80000000, 1}) {
+		t.Errorf("unexpected lists %+v", lists)
+	}
+}
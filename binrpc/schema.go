@@ -0,0 +1,133 @@
+package binrpc
+
+import (
+	"fmt"
+)
+
+// Schema is the layout of a struct Record decoded into a T without reflection, for the responses decoded in hot polling
+// loops. Each key is decoded by a setter of the field of T, registered once in the order of the response:
+//
+//	var shmmemSchema = binrpc.NewSchema[binrpc.SHMMem]().
+//		Int("total", func(m *binrpc.SHMMem) *int { return &m.Total }).
+//		Int("free", func(m *binrpc.SHMMem) *int { return &m.Free })
+//
+//	err := shmmemSchema.Decode(records[0], &shmmem)
+//
+// When the items of the record are in the order of the schema, each key is matched with a string comparison, so
+// decoding does not allocate. Items in another order are looked up by key. Items without field are ignored, and fields
+// without item are left unchanged. The record itself is still decoded by ReadPacket. A Schema is safe for concurrent
+// use once all its fields are registered.
+type Schema[T any] struct {
+	fields []schemaField[T]
+	index  map[string]int
+}
+
+// schemaField is a key of a Schema, and the setter of its field.
+type schemaField[T any] struct {
+	key string
+	set func(dest *T, record *Record) error
+}
+
+// NewSchema returns a Schema without fields.
+func NewSchema[T any]() *Schema[T] {
+	return &Schema[T]{index: map[string]int{}}
+}
+
+// Int registers key, decoded into the int returned by field. A numeric string is converted, like with Scan.
+func (schema *Schema[T]) Int(key string, field func(dest *T) *int) *Schema[T] {
+	return schema.add(key, func(dest *T, record *Record) error {
+		if n, ok := record.Value.(int); ok && record.Type == TypeInt {
+			*field(dest) = n
+			return nil
+		}
+
+		return record.Scan(field(dest))
+	})
+}
+
+// Uint32 registers key, decoded into the uint32 returned by field: the int is not sign-extended, so a bitmask of flags
+// with the high bit set is not negative, like the "unsigned" option of the binrpc tag with Scan.
+func (schema *Schema[T]) Uint32(key string, field func(dest *T) *uint32) *Schema[T] {
+	return schema.add(key, func(dest *T, record *Record) error {
+		n, err := record.uint32()
+
+		if err != nil {
+			return err
+		}
+
+		*field(dest) = n
+
+		return nil
+	})
+}
+
+// String registers key, decoded into the string returned by field. An int or a double is converted, like with Scan.
+func (schema *Schema[T]) String(key string, field func(dest *T) *string) *Schema[T] {
+	return schema.add(key, func(dest *T, record *Record) error {
+		if s, ok := record.Value.(string); ok && record.Type == TypeString {
+			*field(dest) = s
+			return nil
+		}
+
+		return record.Scan(field(dest))
+	})
+}
+
+// Double registers key, decoded into the float64 returned by field. An int or a numeric string is converted, like
+// with Scan.
+func (schema *Schema[T]) Double(key string, field func(dest *T) *float64) *Schema[T] {
+	return schema.add(key, func(dest *T, record *Record) error {
+		if f, ok := record.Value.(float64); ok && record.Type == TypeDouble {
+			*field(dest) = f
+			return nil
+		}
+
+		return record.Scan(field(dest))
+	})
+}
+
+// Record registers key, copied into the Record returned by field, for a value of any type.
+func (schema *Schema[T]) Record(key string, field func(dest *T) *Record) *Schema[T] {
+	return schema.add(key, func(dest *T, record *Record) error {
+		*field(dest) = *record
+
+		return nil
+	})
+}
+
+// add registers key with its setter.
+func (schema *Schema[T]) add(key string, set func(dest *T, record *Record) error) *Schema[T] {
+	schema.index[key] = len(schema.fields)
+	schema.fields = append(schema.fields, schemaField[T]{key: key, set: set})
+
+	return schema
+}
+
+// Decode decodes the items of record, a struct, into dest.
+func (schema *Schema[T]) Decode(record Record, dest *T) error {
+	items, err := record.StructItems()
+
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		item := &items[i]
+
+		var field *schemaField[T]
+
+		if i < len(schema.fields) && schema.fields[i].key == item.Key {
+			field = &schema.fields[i]
+		} else if j, ok := schema.index[item.Key]; ok {
+			field = &schema.fields[j]
+		} else {
+			continue
+		}
+
+		if err := field.set(dest, &item.Value); err != nil {
+			return fmt.Errorf("%s: %w", item.Key, err)
+		}
+	}
+
+	return nil
+}
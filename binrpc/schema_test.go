@@ -0,0 +1,127 @@
+package binrpc
+
+import (
+	"testing"
+)
+
+var shmmemSchema = NewSchema[SHMMem]().
+	Int("total", func(m *SHMMem) *int { return &m.Total }).
+	Int("free", func(m *SHMMem) *int { return &m.Free }).
+	Int("used", func(m *SHMMem) *int { return &m.Used }).
+	Int("real_used", func(m *SHMMem) *int { return &m.RealUsed }).
+	Int("max_used", func(m *SHMMem) *int { return &m.MaxUsed }).
+	Int("fragments", func(m *SHMMem) *int { return &m.Fragments })
+
+var shmmemRecord = Record{Type: TypeStruct, Value: []StructItem{
+	{Key: "total", Value: NewInt(33554432)},
+	{Key: "free", Value: NewInt(30000000)},
+	{Key: "used", Value: NewInt(2000000)},
+	{Key: "real_used", Value: NewInt(3554432)},
+	{Key: "max_used", Value: NewInt(3600000)},
+	{Key: "fragments", Value: NewInt(80)},
+}}
+
+func TestSchemaDecode(t *testing.T) {
+	var shmmem SHMMem
+
+	if err := shmmemSchema.Decode(shmmemRecord, &shmmem); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same result as Scan
+	var scanned SHMMem
+
+	if err := shmmemRecord.Scan(&scanned); err != nil {
+		t.Fatal(err)
+	}
+	if shmmem != scanned {
+		t.Errorf("expected %+v, got %+v", scanned, shmmem)
+	}
+
+	type node struct {
+		URL    string
+		Weight float64
+		Attrs  Record
+		Flags  int
+	}
+
+	schema := NewSchema[node]().
+		String("url", func(n *node) *string { return &n.URL }).
+		Double("weight", func(n *node) *float64 { return &n.Weight }).
+		Record("attrs", func(n *node) *Record { return &n.Attrs }).
+		Int("flags", func(n *node) *int { return &n.Flags })
+
+	// items out of order, unknown and missing
+	record := Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "weight", Value: NewInt(2)},
+		{Key: "unknown", Value: NewString("ignored")},
+		{Key: "url", Value: NewString("sip:10.0.0.1")},
+		{Key: "attrs", Value: Record{Type: TypeArray, Value: []Record{}}},
+	}}
+
+	n := node{Flags: 7}
+
+	if err := schema.Decode(record, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.URL != "sip:10.0.0.1" || n.Weight != 2 || n.Attrs.Type != TypeArray || n.Flags != 7 {
+		t.Errorf("unexpected node %+v", n)
+	}
+
+	invalid := Record{Type: TypeStruct, Value: []StructItem{{Key: "flags", Value: NewString("none")}}}
+
+	if err := schema.Decode(invalid, &n); err == nil {
+		t.Error("expected an error for a non numeric flags")
+	}
+	if err := schema.Decode(NewInt(1), &n); err == nil {
+		t.Error("expected an error for an int")
+	}
+
+	// a struct without value has no items, like for Scan
+	empty := node{Flags: 7}
+
+	if err := schema.Decode(Record{Type: TypeStruct}, &empty); err != nil || empty != (node{Flags: 7}) {
+		t.Errorf("expected an empty struct to leave the node unchanged, got %+v %v", empty, err)
+	}
+	if err := schema.Decode(Record{Type: TypeStruct, Value: "items"}, &empty); err == nil {
+		t.Error("expected an error for a struct with a string value")
+	}
+}
+
+func TestSchemaDecodeAllocs(t *testing.T) {
+	var shmmem SHMMem
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = shmmemSchema.Decode(shmmemRecord, &shmmem)
+	})
+
+	if allocs != 0 {
+		t.Errorf("expected no allocation, got %v", allocs)
+	}
+}
+
+// BenchmarkSchemaDecode compares the decoding of a struct with a Schema and with Scan. The Schema is about 20 times
+// faster, and does not allocate.
+func BenchmarkSchemaDecode(b *testing.B) {
+	var shmmem SHMMem
+
+	b.Run("Schema", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if err := shmmemSchema.Decode(shmmemRecord, &shmmem); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Scan", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if err := shmmemRecord.Scan(&shmmem); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package binrpc
+
+import (
+	"fmt"
+	"io"
+)
+
+// Signatures maps RPC methods to the names of their positional arguments, in the order expected by Kamailio. It is the
+// registry checked by CallBuilder.
+type Signatures map[string][]string
+
+// DefaultSignatures are the arguments of common methods taking a fixed number of arguments. It can be extended in a
+// copy, like DefaultAliases.
+var DefaultSignatures = Signatures{
+	"cfg.seti":             {"group", "name", "value"},
+	"cfg.sets":             {"group", "name", "value"},
+	"dialplan.translate":   {"dpid", "input"},
+	"dispatcher.set_state": {"state", "group", "address"},
+	"htable.delete":        {"table", "key"},
+	"htable.get":           {"table", "key"},
+	"htable.reload":        {"table"},
+	"htable.seti":          {"table", "key", "value"},
+	"htable.sets":          {"table", "key", "value"},
+	"pv.shvSet":            {"name", "type", "value"},
+	"uac.reg_info":         {"attribute", "value"},
+}
+
+// CallBuilder builds the arguments of a call by name, to catch arguments swapped by mistake:
+//
+//	records, err := binrpc.NewCallBuilder().
+//		Add("table", "users").
+//		Add("key", "alice").
+//		Add("value", 42).
+//		Do(conn, "htable.seti")
+//
+// When the method is in its Signatures, Do checks that the arguments have the names of the signature, in the same
+// order, before sending anything. Other methods are called with the arguments in the order they were added. The
+// Signatures default to DefaultSignatures.
+type CallBuilder struct {
+	Signatures Signatures
+
+	names []string
+	args  []Record
+	err   error
+}
+
+// NewCallBuilder returns a CallBuilder without arguments, checking the methods of DefaultSignatures.
+func NewCallBuilder() *CallBuilder {
+	return &CallBuilder{}
+}
+
+// Add adds the argument name with value, converted like Args. An invalid value is returned as an error by Do.
+func (builder *CallBuilder) Add(name string, value any) *CallBuilder {
+	record, err := newArg(value)
+
+	if err != nil && builder.err == nil {
+		builder.err = fmt.Errorf("argument %s: %w", name, err)
+	}
+
+	builder.names = append(builder.names, name)
+	builder.args = append(builder.args, record)
+
+	return builder
+}
+
+// Args returns the arguments for method, or an error if an argument is invalid or they do not match the signature of
+// method.
+func (builder *CallBuilder) Args(method string) ([]Record, error) {
+	if builder.err != nil {
+		return nil, fmt.Errorf("%s: %w", method, builder.err)
+	}
+
+	signatures := builder.Signatures
+
+	if signatures == nil {
+		signatures = DefaultSignatures
+	}
+
+	if signature, ok := signatures[method]; ok {
+		for i, name := range signature {
+			if i >= len(builder.names) {
+				return nil, fmt.Errorf("%s: missing argument %s", method, name)
+			}
+			if builder.names[i] != name {
+				return nil, fmt.Errorf("%s: argument %d is %s, expected %s", method, i, builder.names[i], name)
+			}
+		}
+
+		if len(builder.names) > len(signature) {
+			return nil, fmt.Errorf("%s: unexpected argument %s", method, builder.names[len(signature)])
+		}
+	}
+
+	return builder.args, nil
+}
+
+// Do calls method with the arguments added, see Call.
+func (builder *CallBuilder) Do(rw io.ReadWriter, method string) ([]Record, error) {
+	args, err := builder.Args(method)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Call(rw, method, args...)
+}
@@ -0,0 +1,70 @@
+package binrpc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCallBuilder(t *testing.T) {
+	var request []Record
+
+	conn := serve(t, func(r []Record) (uint8, []Record) {
+		request = r
+
+		return PacketReply, nil
+	})
+
+	_, err := NewCallBuilder().Add("table", "users").Add("key", "alice").Add("value", 42).Do(conn, "htable.seti")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Record{NewString("htable.seti"), NewString("users"), NewString("alice"), NewInt(42)}
+
+	if len(request) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, request)
+	}
+
+	for i := range expected {
+		if !request[i].Equal(expected[i]) {
+			t.Errorf("argument %d: expected %v, got %v", i, expected[i], request[i])
+		}
+	}
+
+	// an unregistered method is called with the arguments in the order they were added
+	if _, err := NewCallBuilder().Add("b", 2).Add("a", 1).Do(conn, "mymodule.command"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := request[1].Int(); n != 2 {
+		t.Errorf("expected 2 first, got %v", request[1])
+	}
+
+	tests := []struct {
+		builder *CallBuilder
+		err     string
+	}{
+		{NewCallBuilder().Add("key", "alice").Add("table", "users").Add("value", 42), "argument 0 is key, expected table"},
+		{NewCallBuilder().Add("table", "users").Add("key", "alice"), "missing argument value"},
+		{NewCallBuilder().Add("table", "users").Add("key", "alice").Add("value", 1).Add("expires", 60), "unexpected argument expires"},
+		{NewCallBuilder().Add("table", "users").Add("key", make(chan int)).Add("value", 42), "argument key"},
+	}
+
+	for _, test := range tests {
+		request = nil
+
+		if _, err := test.builder.Do(conn, "htable.seti"); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected %q, got %v", test.err, err)
+		}
+		if request != nil {
+			t.Error("expected nothing to be sent")
+		}
+	}
+
+	// another registry
+	builder := &CallBuilder{Signatures: Signatures{"mymodule.command": {"a", "b"}}}
+
+	if _, err := builder.Add("b", 2).Add("a", 1).Args("mymodule.command"); err == nil {
+		t.Error("expected an error for arguments out of order")
+	}
+}
@@ -0,0 +1,294 @@
+package binrpc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var typeOfSLCounters = reflect.TypeOf(SLCounters{})
+
+// SLCounters are the counters of the replies sent by the sl module, as returned by "sl.stats".
+// Other holds the counters of this struct unknown to this package, like those added by a later version of Kamailio.
+type SLCounters struct {
+	Code200  int `binrpc:"200"`
+	Code202  int `binrpc:"202"`
+	Class2xx int `binrpc:"2xx"`
+	Code300  int `binrpc:"300"`
+	Code301  int `binrpc:"301"`
+	Code302  int `binrpc:"302"`
+	Class3xx int `binrpc:"3xx"`
+	Code400  int `binrpc:"400"`
+	Code401  int `binrpc:"401"`
+	Code403  int `binrpc:"403"`
+	Code404  int `binrpc:"404"`
+	Code407  int `binrpc:"407"`
+	Code408  int `binrpc:"408"`
+	Code483  int `binrpc:"483"`
+	Class4xx int `binrpc:"4xx"`
+	Code500  int `binrpc:"500"`
+	Class5xx int `binrpc:"5xx"`
+	Class6xx int `binrpc:"6xx"`
+	ClassXxx int `binrpc:"xxx"`
+
+	Other map[string]int `binrpc:"-"`
+}
+
+// ULDomainCounters are the counters of a domain (a table like "location") of the usrloc module.
+type ULDomainCounters struct {
+	Users    int
+	Contacts int
+	Expires  int
+}
+
+// ULCounters are the counters of the usrloc module, from the "usrloc" group of statistics.
+// Other holds the statistics of the group unknown to this package, by name.
+type ULCounters struct {
+	RegisteredUsers int
+	Domains         map[string]ULDomainCounters
+
+	Other map[string]int
+}
+
+// Statistics calls "stats.get_statistics" and returns the statistics by name, like "usrloc:registered_users".
+// Names are statistics like "tm:received_replies", groups like "tm:", or "all" if none is given.
+func Statistics(conn io.ReadWriter, names ...string) (map[string]int, error) {
+	if len(names) == 0 {
+		names = []string{"all"}
+	}
+
+	args := make([]Record, 0, len(names))
+
+	for _, name := range names {
+		args = append(args, NewString(name))
+	}
+
+	records, err := Call(conn, "stats.get_statistics", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]int{}
+
+	for _, record := range records {
+		// each statistic is a string like "usrloc:registered_users = 3", they are returned in an array by some versions
+		items := []Record{record}
+
+		if record.Type == TypeArray {
+			items = record.Value.([]Record)
+		}
+
+		for _, item := range items {
+			line, err := item.String()
+
+			if err != nil {
+				return nil, err
+			}
+
+			name, value, ok := strings.Cut(line, "=")
+
+			if !ok {
+				return nil, fmt.Errorf("invalid statistic %q", line)
+			}
+
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid statistic %q: %w", line, err)
+			}
+
+			stats[strings.TrimSpace(name)] = n
+		}
+	}
+
+	return stats, nil
+}
+
+// MissingStatisticsError is returned by StatisticsInto when statistics are not returned by Kamailio, like those of a
+// module not loaded. Their fields are left unchanged, the other fields are set.
+type MissingStatisticsError struct {
+	Names []string
+}
+
+func (err *MissingStatisticsError) Error() string {
+	return "missing statistics: " + strings.Join(err.Names, ", ")
+}
+
+// StatisticsInto fetches the statistics named by the "stat" tags of the fields of the struct pointed to by dest, and
+// sets each field to its statistic. A name is like "shmem:used_size", or "shmem.used_size" with a dot for the colon:
+//
+//	var snapshot struct {
+//		UsedSize int `stat:"shmem:used_size"`
+//		Replies  int `stat:"tm.received_replies"`
+//	}
+//
+//	err := binrpc.StatisticsInto(conn, &snapshot)
+//
+// Fields without tag are ignored, fields with a tag must be ints or uints. The statistics not returned are reported
+// with a *MissingStatisticsError.
+func StatisticsInto(conn io.ReadWriter, dest any) error {
+	v := reflect.ValueOf(dest)
+
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode statistics into %T, expected a pointer to a struct", dest)
+	}
+
+	v = v.Elem()
+
+	names := []string{}
+	fields := map[string][]int{}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, ok := field.Tag.Lookup("stat")
+
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return fmt.Errorf("cannot decode statistic %s into field %s of type %s", tag, field.Name, field.Type)
+		}
+
+		name := tag
+
+		if !strings.Contains(name, ":") {
+			name = strings.Replace(name, ".", ":", 1)
+		}
+
+		if _, ok := fields[name]; !ok {
+			names = append(names, name)
+		}
+
+		fields[name] = append(fields[name], i)
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	stats, err := Statistics(conn, names...)
+
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+
+	for _, name := range names {
+		value, ok := stats[name]
+
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+
+		for _, i := range fields[name] {
+			field := v.Field(i)
+
+			switch {
+			case field.CanInt() && !field.OverflowInt(int64(value)):
+				field.SetInt(int64(value))
+			case field.CanUint() && value >= 0 && !field.OverflowUint(uint64(value)):
+				field.SetUint(uint64(value))
+			default:
+				return fmt.Errorf("statistic %s = %d overflows field of type %s", name, value, field.Type())
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingStatisticsError{Names: missing}
+	}
+
+	return nil
+}
+
+// SLStats calls "sl.stats" and returns the counters of the replies sent by the sl module.
+func SLStats(conn io.ReadWriter) (SLCounters, error) {
+	records, err := Call(conn, "sl.stats")
+
+	if err != nil {
+		return SLCounters{}, err
+	}
+
+	stats := SLCounters{Other: map[string]int{}}
+
+	if len(records) == 0 {
+		return stats, nil
+	}
+
+	if err := records[0].Scan(&stats); err != nil {
+		return SLCounters{}, err
+	}
+
+	items, _ := records[0].StructItems()
+	fields := structFields(typeOfSLCounters)
+
+	for _, item := range items {
+		if _, ok := fields.lookup(item.Key); ok {
+			continue
+		}
+
+		var n int
+
+		if err := item.Value.Scan(&n); err != nil {
+			return SLCounters{}, fmt.Errorf("%s: %w", item.Key, err)
+		}
+
+		stats.Other[item.Key] = n
+	}
+
+	return stats, nil
+}
+
+// ULStats returns the counters of the usrloc module, from the statistics of the "usrloc" group.
+func ULStats(conn io.ReadWriter) (ULCounters, error) {
+	stats, err := Statistics(conn, "usrloc:")
+
+	if err != nil {
+		return ULCounters{}, err
+	}
+
+	ul := ULCounters{Domains: map[string]ULDomainCounters{}, Other: map[string]int{}}
+
+	for name, value := range stats {
+		name = strings.TrimPrefix(name, "usrloc:")
+
+		if name == "registered_users" {
+			ul.RegisteredUsers = value
+			continue
+		}
+
+		// the counters of a domain are named after it, like "location-users": the domain may contain "-" too
+		var domain, counter string
+
+		if i := strings.LastIndex(name, "-"); i >= 0 {
+			domain, counter = name[:i], name[i+1:]
+		}
+
+		domainStats := ul.Domains[domain]
+
+		switch counter {
+		case "users":
+			domainStats.Users = value
+		case "contacts":
+			domainStats.Contacts = value
+		case "expires":
+			domainStats.Expires = value
+		default:
+			ul.Other[name] = value
+			continue
+		}
+
+		ul.Domains[domain] = domainStats
+	}
+
+	return ul, nil
+}
@@ -0,0 +1,165 @@
+package binrpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStatistics(t *testing.T) {
+	var request []Record
+
+	conn := serve(t, func(r []Record) (uint8, []Record) {
+		request = r
+
+		return PacketReply, []Record{
+			NewString("tm:received_replies = 12"),
+			{Type: TypeArray, Value: []Record{NewString("tm:current = 0")}},
+		}
+	})
+
+	stats, err := Statistics(conn, "tm:")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"tm:received_replies": 12, "tm:current": 0}
+
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %v, got %v", expected, stats)
+	}
+	if group, _ := request[1].String(); group != "tm:" {
+		t.Errorf(`expected "tm:", got "%s"`, group)
+	}
+
+	if _, err := Statistics(conn); err != nil {
+		t.Error(err)
+	}
+	if group, _ := request[1].String(); group != "all" {
+		t.Errorf(`expected "all", got "%s"`, group)
+	}
+}
+
+func TestStatisticsInto(t *testing.T) {
+	var request []Record
+
+	conn := serve(t, func(r []Record) (uint8, []Record) {
+		request = r
+
+		return PacketReply, []Record{
+			NewString("shmem:used_size = 2048"),
+			NewString("tm:received_replies = 12"),
+		}
+	})
+
+	var snapshot struct {
+		UsedSize int    `stat:"shmem:used_size"`
+		Replies  uint32 `stat:"tm.received_replies"`
+		Users    int64  `stat:"usrloc:registered_users"`
+		Ignored  int
+	}
+
+	snapshot.Users = -1
+	err := StatisticsInto(conn, &snapshot)
+
+	var missing *MissingStatisticsError
+
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"usrloc:registered_users"}) {
+		t.Errorf("expected usrloc:registered_users to be missing, got %v", err)
+	}
+	if snapshot.UsedSize != 2048 || snapshot.Replies != 12 || snapshot.Users != -1 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+
+	// the names are requested in the order of the fields
+	names := []string{}
+
+	for _, record := range request[1:] {
+		name, _ := record.String()
+		names = append(names, name)
+	}
+
+	if expected := []string{"shmem:used_size", "tm:received_replies", "usrloc:registered_users"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	var small struct {
+		UsedSize int8 `stat:"shmem:used_size"`
+	}
+
+	if err := StatisticsInto(conn, &small); err == nil {
+		t.Error("expected an error for an overflow")
+	}
+
+	var invalid struct {
+		Name string `stat:"shmem:used_size"`
+	}
+
+	if err := StatisticsInto(conn, &invalid); err == nil {
+		t.Error("expected an error for a string field")
+	}
+	if err := StatisticsInto(conn, snapshot); err == nil {
+		t.Error("expected an error for a struct not passed by pointer")
+	}
+}
+
+func TestSLStats(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{{Type: TypeStruct, Value: []StructItem{
+			{Key: "200", Value: NewInt(120)},
+			{Key: "2xx", Value: NewInt(125)},
+			{Key: "404", Value: NewInt(7)},
+			{Key: "4xx", Value: NewInt(9)},
+			{Key: "xxx", Value: NewInt(1)},
+			{Key: "488", Value: NewInt(2)},
+		}}}
+	})
+
+	stats, err := SLStats(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Code200 != 120 || stats.Class2xx != 125 || stats.Code404 != 7 || stats.Class4xx != 9 || stats.ClassXxx != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(stats.Other) != 1 || stats.Other["488"] != 2 {
+		t.Errorf("unexpected other stats %v", stats.Other)
+	}
+}
+
+func TestULStats(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{
+			NewString("usrloc:registered_users = 42"),
+			NewString("usrloc:location-users = 40"),
+			NewString("usrloc:location-contacts = 51"),
+			NewString("usrloc:location-expires = 3"),
+			NewString("usrloc:aliases-users = 2"),
+			NewString("usrloc:sip-example.com-contacts = 7"),
+			NewString("usrloc:something_new = 5"),
+		}
+	})
+
+	stats, err := ULStats(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ULCounters{
+		RegisteredUsers: 42,
+		Domains: map[string]ULDomainCounters{
+			"location":        {Users: 40, Contacts: 51, Expires: 3},
+			"aliases":         {Users: 2},
+			"sip-example.com": {Contacts: 7},
+		},
+		Other: map[string]int{"something_new": 5},
+	}
+
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+}
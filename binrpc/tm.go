@@ -0,0 +1,146 @@
+package binrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UACRequest is a SIP request sent by the tm module with "tm.t_uac_start" or "tm.t_uac_wait". The named fields are
+// converted to the positional arguments of these methods, in their order.
+//
+// From and To are the values of the From and To headers, like "<sip:alice@example.com>;tag=1234": the tm module
+// requires them. Headers are the other header lines, like "Contact: <sip:bot@10.0.0.1>", without line ending. The body
+// needs a Content-Type header, the Content-Length is added by the tm module.
+type UACRequest struct {
+	Method string
+	RURI   string
+	// NextHop is the URI the request is sent to instead of RURI, empty to use RURI.
+	NextHop string
+	// SendSocket is the listening socket to send from, like "udp:10.0.0.1:5060", empty to let Kamailio choose.
+	SendSocket string
+
+	From    string
+	To      string
+	Headers []string
+	Body    string
+}
+
+// UACResult is the final reply to a request sent with "tm.t_uac_wait", like 200 "OK", or 408 "Request Timeout" if no
+// reply was received. Headers and Body are those of the reply, when returned by the version of Kamailio.
+type UACResult struct {
+	Code    int
+	Reason  string
+	Headers string
+	Body    string
+}
+
+// TMUACStart sends request with "tm.t_uac_start", and returns without waiting for the replies.
+func TMUACStart(conn io.ReadWriter, request UACRequest) error {
+	args, err := request.args()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = Call(conn, "tm.t_uac_start", args...)
+
+	return err
+}
+
+// TMUACWait sends request with "tm.t_uac_wait", and returns its final reply. The response is delayed by Kamailio
+// until the transaction completes, so the read timeout of conn must be longer than the timeout of the transaction.
+func TMUACWait(conn io.ReadWriter, request UACRequest) (UACResult, error) {
+	args, err := request.args()
+
+	if err != nil {
+		return UACResult{}, err
+	}
+
+	records, err := Call(conn, "tm.t_uac_wait", args...)
+
+	if err != nil {
+		return UACResult{}, err
+	}
+
+	return newUACResult(records)
+}
+
+// args returns the arguments of "tm.t_uac_start" and "tm.t_uac_wait": method, ruri, next hop, send socket, headers
+// and an optional body. An empty next hop or send socket is sent as ".".
+func (request UACRequest) args() ([]Record, error) {
+	if request.Method == "" {
+		return nil, errors.New("missing method")
+	}
+	if request.From == "" || request.To == "" {
+		return nil, errors.New("missing From or To header")
+	}
+
+	ruri, err := NewURI(request.RURI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nextHop := NewString(".")
+
+	if request.NextHop != "" {
+		if nextHop, err = NewURI(request.NextHop); err != nil {
+			return nil, err
+		}
+	}
+
+	sendSocket := request.SendSocket
+
+	if sendSocket == "" {
+		sendSocket = "."
+	}
+
+	var headers strings.Builder
+
+	headers.WriteString("From: " + request.From + "\r\n")
+	headers.WriteString("To: " + request.To + "\r\n")
+
+	for _, header := range request.Headers {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q: contains a line ending", header)
+		}
+
+		headers.WriteString(header + "\r\n")
+	}
+
+	args := []Record{NewString(request.Method), ruri, nextHop, NewString(sendSocket), NewString(headers.String())}
+
+	if request.Body != "" {
+		args = append(args, NewString(request.Body))
+	}
+
+	return args, nil
+}
+
+// newUACResult converts the records of a "tm.t_uac_wait" response: the code and reason of the reply, followed by its
+// headers and body in some versions.
+func newUACResult(records []Record) (UACResult, error) {
+	result := UACResult{}
+
+	if len(records) < 2 {
+		return result, fmt.Errorf("invalid reply: %d records", len(records))
+	}
+
+	if err := records[0].Scan(&result.Code); err != nil {
+		return result, fmt.Errorf("invalid reply code: %w", err)
+	}
+	if err := records[1].Scan(&result.Reason); err != nil {
+		return result, fmt.Errorf("invalid reply reason: %w", err)
+	}
+
+	if len(records) > 2 {
+		result.Headers = records[2].StringOr("")
+	}
+	if len(records) > 3 {
+		result.Body = records[3].StringOr("")
+	}
+
+	return result, nil
+}
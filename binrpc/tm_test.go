@@ -0,0 +1,117 @@
+package binrpc
+
+import (
+	"testing"
+)
+
+func TestTMUACWait(t *testing.T) {
+	var request []Record
+
+	conn := serve(t, func(r []Record) (uint8, []Record) {
+		request = r
+
+		return PacketReply, []Record{NewInt(200), NewString("OK"), NewString("Contact: <sip:bob@10.0.0.2>\r\n")}
+	})
+
+	result, err := TMUACWait(conn, UACRequest{
+		Method:  "OPTIONS",
+		RURI:    "sip:bob@example.com",
+		From:    "<sip:bot@example.com>;tag=1234",
+		To:      "<sip:bob@example.com>",
+		Headers: []string{"Max-Forwards: 10"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := UACResult{Code: 200, Reason: "OK", Headers: "Contact: <sip:bob@10.0.0.2>\r\n"}
+
+	if result != expected {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	args := []string{
+		"tm.t_uac_wait",
+		"OPTIONS",
+		"sip:bob@example.com",
+		".",
+		".",
+		"From: <sip:bot@example.com>;tag=1234\r\nTo: <sip:bob@example.com>\r\nMax-Forwards: 10\r\n",
+	}
+
+	if len(request) != len(args) {
+		t.Fatalf("expected %d arguments, got %v", len(args), request)
+	}
+
+	for i, arg := range args {
+		if s, _ := request[i].String(); s != arg {
+			t.Errorf("argument %d: expected %q, got %q", i, arg, s)
+		}
+	}
+}
+
+func TestTMUACStart(t *testing.T) {
+	var request []Record
+
+	conn := serve(t, func(r []Record) (uint8, []Record) {
+		request = r
+
+		return PacketReply, nil
+	})
+
+	err := TMUACStart(conn, UACRequest{
+		Method:     "MESSAGE",
+		RURI:       "sip:bob@example.com",
+		NextHop:    "sip:10.0.0.2:5060",
+		SendSocket: "udp:10.0.0.1:5060",
+		From:       "<sip:bot@example.com>;tag=1234",
+		To:         "<sip:bob@example.com>",
+		Headers:    []string{"Content-Type: text/plain"},
+		Body:       "hello",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(request) != 7 {
+		t.Fatalf("expected 7 arguments, got %v", request)
+	}
+	if s, _ := request[3].String(); s != "sip:10.0.0.2:5060" {
+		t.Errorf("unexpected next hop %q", s)
+	}
+	if s, _ := request[4].String(); s != "udp:10.0.0.1:5060" {
+		t.Errorf("unexpected send socket %q", s)
+	}
+	if s, _ := request[6].String(); s != "hello" {
+		t.Errorf("unexpected body %q", s)
+	}
+}
+
+func TestUACRequestInvalid(t *testing.T) {
+	valid := UACRequest{Method: "OPTIONS", RURI: "sip:bob@example.com", From: "<sip:a@b>", To: "<sip:b@b>"}
+
+	if _, err := valid.args(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, modify := range []func(request *UACRequest){
+		func(request *UACRequest) { request.Method = "" },
+		func(request *UACRequest) { request.RURI = "bob@example.com" },
+		func(request *UACRequest) { request.NextHop = "10.0.0.2" },
+		func(request *UACRequest) { request.To = "" },
+		func(request *UACRequest) { request.Headers = []string{"X-Injected: a\r\nVia: b"} },
+	} {
+		request := valid
+		modify(&request)
+
+		if _, err := request.args(); err == nil {
+			t.Errorf("expected an error for %+v", request)
+		}
+	}
+
+	if _, err := newUACResult([]Record{NewInt(200)}); err == nil {
+		t.Error("expected an error for a reply without reason")
+	}
+}
@@ -0,0 +1,76 @@
+package binrpc
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+)
+
+// transformedConn is a connection read and written through rwc, see WithTransform. The deadlines and the addresses
+// are the ones of the underlying connection.
+type transformedConn struct {
+	net.Conn
+
+	rwc io.ReadWriteCloser
+}
+
+func (conn *transformedConn) Read(p []byte) (int, error) {
+	return conn.rwc.Read(p)
+}
+
+func (conn *transformedConn) Write(p []byte) (int, error) {
+	return conn.rwc.Write(p)
+}
+
+// Close closes rwc, then the underlying connection.
+func (conn *transformedConn) Close() error {
+	return errors.Join(conn.rwc.Close(), conn.Conn.Close())
+}
+
+// GzipTransform is a transform for WithTransform, compressing the requests and decompressing the responses with gzip,
+// for BINRPC tunneled through a compressing proxy. BINRPC has no compression of its own: the other end must be a
+// proxy decompressing the requests to the ctl module, and compressing its responses.
+//
+// Each direction of the connection is a single gzip stream. Each write is flushed, so a request is sent as soon as it
+// is written.
+func GzipTransform(conn net.Conn) (io.ReadWriteCloser, error) {
+	return &gzipConn{conn: conn, writer: gzip.NewWriter(conn)}, nil
+}
+
+// gzipConn compresses the writes to conn, and decompresses its reads.
+type gzipConn struct {
+	conn   net.Conn
+	writer *gzip.Writer
+	reader *gzip.Reader
+}
+
+func (conn *gzipConn) Read(p []byte) (int, error) {
+	// the reader is created on the first read, as it reads the gzip header
+	if conn.reader == nil {
+		reader, err := gzip.NewReader(conn.conn)
+
+		if err != nil {
+			return 0, err
+		}
+
+		conn.reader = reader
+	}
+
+	return conn.reader.Read(p)
+}
+
+func (conn *gzipConn) Write(p []byte) (int, error) {
+	n, err := conn.writer.Write(p)
+
+	if err != nil {
+		return n, err
+	}
+
+	return n, conn.writer.Flush()
+}
+
+// Close ends the gzip stream of the writes, without closing conn.
+func (conn *gzipConn) Close() error {
+	return conn.writer.Close()
+}
@@ -0,0 +1,124 @@
+package binrpc
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+
+	read *atomic.Int64
+}
+
+func (conn countingConn) Read(p []byte) (int, error) {
+	n, err := conn.Conn.Read(p)
+	conn.read.Add(int64(n))
+
+	return n, err
+}
+
+func TestClientGzipTransform(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	received := &atomic.Int64{}
+
+	// a compressing proxy in front of Kamailio, answering with a large compressible dump
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader, err := gzip.NewReader(conn)
+
+				if err != nil {
+					return
+				}
+
+				dec := NewDecoder(reader)
+				writer := gzip.NewWriter(conn)
+
+				for {
+					header, request, err := dec.readPacket(0)
+
+					if err != nil {
+						return
+					}
+
+					dump := NewString(strings.Repeat("sip:10.0.0.1:5060;transport=tcp ", 10000))
+
+					if err := writePacket(writer, header.Cookie, PacketReply, append(request[1:], dump)); err != nil {
+						return
+					}
+					if err := writer.Flush(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	transform := func(conn net.Conn) (io.ReadWriteCloser, error) {
+		return GzipTransform(countingConn{Conn: conn, read: received})
+	}
+
+	client, err := New("tcp:"+listener.Addr().String(), WithTimeout(5*time.Second), WithTransform(transform))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		records, err := client.Call(context.Background(), "core.echo", NewInt(i))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := records[0].Int(); n != i {
+			t.Errorf("expected %d, got %d", i, n)
+		}
+		if s, _ := records[1].String(); len(s) != 320000 {
+			t.Errorf("expected the dump, got %d bytes", len(s))
+		}
+	}
+
+	// the dumps were compressed on the wire
+	if n := received.Load(); n > 100000 {
+		t.Errorf("expected compressed responses, read %d bytes", n)
+	}
+
+	failing := func(conn net.Conn) (io.ReadWriteCloser, error) {
+		return nil, io.ErrClosedPipe
+	}
+
+	client, err = New("tcp:"+listener.Addr().String(), WithTransform(failing))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Call(context.Background(), "core.echo"); err != io.ErrClosedPipe {
+		t.Errorf("expected the error of the transform, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package binrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Transport sends an RPC call to Kamailio and returns the records of the response, like Call on a connection to the
+// ctl module. A fault is returned as an *RPCError. The call is abandoned when ctx is done.
+//
+// The typed helpers of this package take the io.ReadWriter of a BINRPC connection: wrap a Transport with NewConn to
+// use them over another transport, like JSONRPCTransport.
+type Transport interface {
+	RoundTrip(ctx context.Context, method string, args []Record) ([]Record, error)
+}
+
+// BINRPCTransport is the Transport of a BINRPC connection to the ctl module, calling methods with Call.
+type BINRPCTransport struct {
+	Conn io.ReadWriter
+}
+
+// RoundTrip calls method with args on the connection. When Conn is a net.Conn, a done ctx interrupts the call by
+// expiring the deadline of the connection, which cannot be reused then.
+func (transport BINRPCTransport) RoundTrip(ctx context.Context, method string, args []Record) ([]Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if conn, ok := transport.Conn.(net.Conn); ok {
+		stop := context.AfterFunc(ctx, func() {
+			conn.SetDeadline(time.Now())
+		})
+
+		defer stop()
+	}
+
+	records, err := Call(transport.Conn, method, args...)
+
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return records, err
+}
+
+// NewConn returns a connection calling methods with transport, for the helpers of this package taking an io.ReadWriter:
+//
+//	conn := binrpc.NewConn(&binrpc.JSONRPCTransport{URL: "http://localhost:5060/RPC"})
+//	shmmem, err := binrpc.CoreSHMMem(conn)
+//
+// Call and the helpers built on it pass the records of the request to transport, and return the records of its
+// response as they are, with the context.Background context: ints and doubles are not limited to the 32 bits of
+// BINRPC. An array result of JSONRPCTransport is returned as its items, see its documentation.
+//
+// The connection can also be written and read like a BINRPC connection, by Send and ReadN for example: each request
+// packet written is decoded and sent with transport, and its response is encoded in a packet read from the connection,
+// with the cookie of the request. Writes fail if the transport fails for another reason than a fault, or if the
+// response has a value that BINRPC cannot represent, like an int above math.MaxInt32 or a double with more than 3
+// decimals. The connection is not safe for concurrent use.
+func NewConn(transport Transport) io.ReadWriter {
+	return &transportConn{transport: transport}
+}
+
+// recordCaller is implemented by the connections of NewConn, calling methods with records instead of packets.
+type recordCaller interface {
+	callRecords(method string, args []Record) ([]Record, error)
+}
+
+// transportConn is the connection returned by NewConn.
+type transportConn struct {
+	transport Transport
+	requests  bytes.Buffer
+	responses bytes.Buffer
+}
+
+func (conn *transportConn) Write(p []byte) (int, error) {
+	conn.requests.Write(p)
+
+	for {
+		size, ok := packetSize(conn.requests.Bytes())
+
+		if !ok {
+			return len(p), nil
+		}
+
+		if err := conn.roundTrip(conn.requests.Next(size)); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (conn *transportConn) Read(p []byte) (int, error) {
+	return conn.responses.Read(p)
+}
+
+func (conn *transportConn) callRecords(method string, args []Record) ([]Record, error) {
+	return conn.transport.RoundTrip(context.Background(), method, args)
+}
+
+// roundTrip sends the request packet in data with the transport, and buffers its response packet.
+func (conn *transportConn) roundTrip(data []byte) error {
+	header, request, err := DecodePacket(data)
+
+	if err != nil {
+		return err
+	}
+
+	if header.Flags != PacketRequest || len(request) == 0 {
+		return errors.New("not a request")
+	}
+
+	method, err := request[0].String()
+
+	if err != nil {
+		return fmt.Errorf("invalid method: %w", err)
+	}
+
+	flags := PacketReply
+	records, err := conn.transport.RoundTrip(context.Background(), method, request[1:])
+
+	var rpcErr *RPCError
+
+	if errors.As(err, &rpcErr) {
+		flags = PacketFault
+		records = []Record{NewInt(rpcErr.Code), NewString(rpcErr.Message)}
+	} else if err != nil {
+		return err
+	}
+
+	for i := range records {
+		if err := checkRepresentable(records[i]); err != nil {
+			return fmt.Errorf("%s: cannot read the response: %w", method, err)
+		}
+	}
+
+	return writePacket(&conn.responses, header.Cookie, flags, records)
+}
+
+// checkRepresentable returns an error if the value of record, or of one of its items, would be changed by writing it in
+// a BINRPC packet: ints are signed 32 bits, and doubles are sent as an int number of thousandths.
+func checkRepresentable(record Record) error {
+	switch value := record.Value.(type) {
+	case int:
+		// an int above math.MaxInt32 would be read back as negative
+		if int64(value) < math.MinInt32 || int64(value) > math.MaxInt32 {
+			return fmt.Errorf("int %d does not fit in 32 bits", value)
+		}
+	case float64:
+		n := math.Round(value * 1000)
+
+		if math.IsNaN(value) || math.IsInf(value, 0) || n < math.MinInt32 || n > math.MaxInt32 {
+			return fmt.Errorf("double %g does not fit in 32 bits", value)
+		}
+		if n/1000 != value {
+			return fmt.Errorf("double %g has more than 3 decimals", value)
+		}
+	case []StructItem:
+		for _, item := range value {
+			if err := checkRepresentable(item.Value); err != nil {
+				return fmt.Errorf("%s: %w", item.Key, err)
+			}
+		}
+	case []Record:
+		for i := range value {
+			if err := checkRepresentable(value[i]); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// packetSize returns the size of the packet at the start of data, and false if data does not hold a complete packet.
+func packetSize(data []byte) (int, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+
+	sizeOfLength := int(data[1]&0x0C>>2 + 1)
+	sizeOfCookie := int(data[1]&0x3 + 1)
+	sizeOfHeader := 2 + sizeOfLength + sizeOfCookie
+
+	if len(data) < sizeOfHeader {
+		return 0, false
+	}
+
+	var length uint64
+
+	for _, b := range data[2 : 2+sizeOfLength] {
+		length = length<<8 | uint64(b)
+	}
+
+	if uint64(len(data)) < uint64(sizeOfHeader)+length {
+		return 0, false
+	}
+
+	return sizeOfHeader + int(length), true
+}
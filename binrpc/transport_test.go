@@ -0,0 +1,287 @@
+package binrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// jsonRPCServer starts a fake jsonrpcs module, answering each request with the JSON body returned by handler.
+func jsonRPCServer(t *testing.T, handler func(method string, params []any) string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+			ID     uint32 `json:"id"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+			return
+		}
+
+		io.WriteString(w, handler(request.Method, request.Params))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+func TestJSONRPCTransport(t *testing.T) {
+	url := jsonRPCServer(t, func(method string, params []any) string {
+		switch method {
+		case "core.shmmem":
+			return `{"jsonrpc":"2.0","result":{"total":1024,"free":512,"used":256,"real_used":512,"max_used":600,"fragments":3},"id":1}`
+		case "core.version":
+			return `{"jsonrpc":"2.0","result":"kamailio 5.7.4 (x86_64/linux) 0f9a3f","id":1}`
+		case "core.echo":
+			data, _ := json.Marshal(params)
+			return `{"jsonrpc":"2.0","result":` + string(data) + `,"id":1}`
+		case "dispatcher.list":
+			return `{"jsonrpc":"2.0","result":{"z":1,"a":{"ratio":0.5,"up":true}},"id":1}`
+		}
+
+		return `{"jsonrpc":"2.0","error":{"code":500,"message":"Method Not Found"},"id":1}`
+	})
+
+	conn := NewConn(&JSONRPCTransport{URL: url})
+
+	// the typed helpers work unchanged
+	shmmem, err := CoreSHMMem(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shmmem.Total != 1024 || shmmem.Fragments != 3 {
+		t.Errorf("unexpected shmmem %+v", shmmem)
+	}
+
+	if version, err := ServerInfo(conn); err != nil || !version.AtLeast(5, 7) {
+		t.Errorf("unexpected version %v %v", version, err)
+	}
+
+	// an array result is returned as its items
+	records, err := Call(conn, "core.echo", NewString("a"), NewInt(2), NewDouble(1.5))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Record{NewString("a"), NewInt(2), NewDouble(1.5)}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %v", len(expected), records)
+	}
+
+	for i, record := range records {
+		if !record.Equal(expected[i]) {
+			t.Errorf("record %d: expected %v, got %v", i, expected[i], record)
+		}
+	}
+
+	// objects keep their order
+	records, err = Call(conn, "dispatcher.list")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []Record{{Type: TypeStruct, Value: []StructItem{
+		{Key: "z", Value: NewInt(1)},
+		{Key: "a", Value: Record{Type: TypeStruct, Value: []StructItem{
+			{Key: "ratio", Value: NewDouble(0.5)},
+			{Key: "up", Value: NewInt(1)},
+		}}},
+	}}}
+
+	if len(records) != 1 || !records[0].Equal(expected[0]) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+
+	_, err = Call(conn, "core.bogus")
+
+	var rpcErr *RPCError
+
+	if !errors.As(err, &rpcErr) || !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected ErrMethodNotFound in an *RPCError, got %v", err)
+	}
+
+	// the connection is still usable after a fault
+	if _, err := CoreSHMMem(conn); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBINRPCTransport(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if method, _ := request[0].String(); method == "core.bogus" {
+			return fault(500, "command core.bogus not found")
+		}
+
+		return PacketReply, request[1:]
+	})
+
+	wrapped := NewConn(BINRPCTransport{Conn: conn})
+
+	record, err := CallOne(wrapped, "core.echo", NewString("bonjour"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := record.String(); s != "bonjour" {
+		t.Errorf(`expected "bonjour", got "%s"`, s)
+	}
+
+	// the fault is forwarded with its code and message
+	if _, err := Call(wrapped, "core.bogus"); !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected ErrMethodNotFound, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := (BINRPCTransport{Conn: conn}).RoundTrip(ctx, "core.echo", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestNewConnValues(t *testing.T) {
+	url := jsonRPCServer(t, func(method string, params []any) string {
+		switch method {
+		case "core.shmmem":
+			// more than 4GB of shared memory
+			return `{"jsonrpc":"2.0","result":{"total":8589934592,"free":3221225472,"used":2147483648},"id":1}`
+		case "stats.large":
+			return `{"jsonrpc":"2.0","result":{"load":3000000.5},"id":1}`
+		case "stats.small":
+			return `{"jsonrpc":"2.0","result":[1,0.00049],"id":1}`
+		}
+
+		return `{"jsonrpc":"2.0","result":{"flags":2147483647,"load":-2147483.648,"ratio":0.125},"id":1}`
+	})
+
+	conn := NewConn(&JSONRPCTransport{URL: url})
+
+	// the records of the transport are returned without the limits of BINRPC
+	shmmem, err := CoreSHMMem(conn)
+
+	if strconv.IntSize == 32 {
+		// ints above math.MaxInt32 do not fit in an int on 32-bit platforms
+		if err == nil {
+			t.Errorf("expected an error, got %+v", shmmem)
+		}
+	} else if err != nil || int64(shmmem.Total) != 8589934592 || int64(shmmem.Free) != 3221225472 || int64(shmmem.Used) != 2147483648 {
+		t.Errorf("unexpected shmmem %+v %v", shmmem, err)
+	}
+
+	var load struct {
+		Load float64 `binrpc:"load"`
+	}
+
+	if err := CallInto(conn, &load, "stats.large"); err != nil || load.Load != 3000000.5 {
+		t.Errorf("expected 3000000.5 unchanged, got %v %v", load.Load, err)
+	}
+
+	records, err := Call(conn, "stats.small")
+
+	if err != nil || len(records) != 2 || records[1].Value != 0.00049 {
+		t.Errorf("expected 0.00049 unchanged, got %v %v", records, err)
+	}
+
+	// written and read as packets, the values that BINRPC cannot represent fail
+	for method, message := range map[string]string{
+		"stats.large": "stats.large: cannot read the response: load: double 3.0000005e+06 does not fit in 32 bits",
+		"stats.small": "stats.small: cannot read the response: double 0.00049 has more than 3 decimals",
+	} {
+		if err := Send(conn, method); err == nil || err.Error() != message {
+			t.Errorf("%s: expected %q, got %v", method, message, err)
+		}
+	}
+
+	if strconv.IntSize == 64 {
+		if err := Send(conn, "core.shmmem"); err == nil || !strings.Contains(err.Error(), "int 8589934592 does not fit") {
+			t.Errorf("expected an error for an int above 2^32, got %v", err)
+		}
+	}
+
+	if err := Send(conn, "stats.fit"); err != nil {
+		t.Fatal(err)
+	}
+
+	responses, err := ReadN(conn, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NewStruct(
+		StructItem{Key: "flags", Value: NewInt(math.MaxInt32)},
+		StructItem{Key: "load", Value: NewDouble(-2147483.648)},
+		StructItem{Key: "ratio", Value: NewDouble(0.125)},
+	)
+
+	if len(responses[0]) != 1 || !responses[0][0].Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, responses)
+	}
+}
+
+func TestCheckRepresentable(t *testing.T) {
+	// above math.MaxInt32, an int would be read back as negative
+	if strconv.IntSize == 64 {
+		above := int64(math.MaxInt32) + 1
+
+		for _, record := range []Record{NewInt(int(above)), NewInt(int(-above - 1)), NewInt(int(above * 2))} {
+			if err := checkRepresentable(record); err == nil {
+				t.Errorf("%v: expected an error", record.Value)
+			}
+		}
+	}
+
+	for _, record := range []Record{NewInt(math.MaxInt32), NewInt(math.MinInt32), NewDouble(2147483.647)} {
+		if err := checkRepresentable(record); err != nil {
+			t.Errorf("%v: %v", record.Value, err)
+		}
+	}
+}
+
+func TestJSONRPCTransportStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fault" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"jsonrpc":"2.0","error":{"code":500,"message":"Method Not Found"},"id":1}`)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, "<html>Bad Gateway</html>")
+	}))
+
+	t.Cleanup(server.Close)
+
+	transport := JSONRPCTransport{URL: server.URL}
+
+	if _, err := transport.RoundTrip(context.Background(), "core.uptime", nil); err == nil || err.Error() != "http status 502 Bad Gateway" {
+		t.Errorf("expected the http status, got %v", err)
+	}
+
+	transport.URL += "/fault"
+
+	if _, err := transport.RoundTrip(context.Background(), "core.bogus", nil); !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("expected ErrMethodNotFound, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := transport.RoundTrip(ctx, "core.uptime", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package binrpc
+
+import (
+	"errors"
+	"io"
+)
+
+// UACRegDisabled, UACRegOngoing, UACRegOnline, UACRegAuthSent and UACRegInit are the bits of the flags of a registration.
+const (
+	UACRegDisabled = 1 << 0
+	UACRegOngoing  = 1 << 1
+	UACRegOnline   = 1 << 2
+	UACRegAuthSent = 1 << 3
+	UACRegInit     = 1 << 4
+)
+
+// UACRegistration is a remote registration of the uac module, as returned by "uac.reg_dump" and "uac.reg_info".
+// Times (TimerExpires, RegInit) are unix timestamps, and the password is not exposed.
+type UACRegistration struct {
+	LUUID        string
+	LUsername    string
+	LDomain      string
+	RUsername    string
+	RDomain      string
+	Realm        string
+	AuthUsername string
+	AuthProxy    string
+	Expires      int
+	Flags        int
+	DiffExpires  int
+	TimerExpires int
+	RegInit      int
+	RegDelay     int
+	ContactAddr  string
+	Socket       string
+}
+
+// UACRegFlags is the decoded Flags bitmask of a UACRegistration.
+type UACRegFlags struct {
+	Disabled bool
+	Ongoing  bool
+	Online   bool
+	AuthSent bool
+	Init     bool
+}
+
+// DecodeFlags returns the decoded Flags bitmask.
+func (reg UACRegistration) DecodeFlags() UACRegFlags {
+	return UACRegFlags{
+		Disabled: reg.Flags&UACRegDisabled != 0,
+		Ongoing:  reg.Flags&UACRegOngoing != 0,
+		Online:   reg.Flags&UACRegOnline != 0,
+		AuthSent: reg.Flags&UACRegAuthSent != 0,
+		Init:     reg.Flags&UACRegInit != 0,
+	}
+}
+
+// UACRegDump calls "uac.reg_dump" and returns all the remote registrations.
+func UACRegDump(conn io.ReadWriter) ([]UACRegistration, error) {
+	records, err := Call(conn, "uac.reg_dump")
+
+	if err != nil {
+		return nil, err
+	}
+
+	registrations := []UACRegistration{}
+
+	for _, record := range records {
+		// each registration is a top level struct, but accept them wrapped in an array
+		items := []Record{record}
+
+		if record.Type == TypeArray {
+			items = record.Value.([]Record)
+		}
+
+		for _, item := range items {
+			reg, err := newUACRegistration(item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			registrations = append(registrations, *reg)
+		}
+	}
+
+	return registrations, nil
+}
+
+// UACRegInfo calls "uac.reg_info" and returns the remote registration where attribute (like "l_uuid") matches value.
+func UACRegInfo(conn io.ReadWriter, attribute, value string) (*UACRegistration, error) {
+	records, err := Call(conn, "uac.reg_info",
+		Record{Type: TypeString, Value: attribute},
+		Record{Type: TypeString, Value: value},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("empty response")
+	}
+
+	return newUACRegistration(records[0])
+}
+
+func newUACRegistration(record Record) (*UACRegistration, error) {
+	items, err := record.StructItems()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reg := UACRegistration{}
+
+	fields := map[string]any{
+		"l_uuid":        &reg.LUUID,
+		"l_username":    &reg.LUsername,
+		"l_domain":      &reg.LDomain,
+		"r_username":    &reg.RUsername,
+		"r_domain":      &reg.RDomain,
+		"realm":         &reg.Realm,
+		"auth_username": &reg.AuthUsername,
+		"auth_proxy":    &reg.AuthProxy,
+		"expires":       &reg.Expires,
+		"flags":         &reg.Flags,
+		"diff_expires":  &reg.DiffExpires,
+		"timer_expires": &reg.TimerExpires,
+		"reg_init":      &reg.RegInit,
+		"reg_delay":     &reg.RegDelay,
+		"contact_addr":  &reg.ContactAddr,
+		"socket":        &reg.Socket,
+	}
+
+	for _, item := range items {
+		if dest, ok := fields[item.Key]; ok {
+			if err := item.Value.Scan(dest); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &reg, nil
+}
@@ -0,0 +1,74 @@
+package binrpc
+
+import (
+	"testing"
+)
+
+func uacRegistrationRecord(uuid string, flags int) Record {
+	return Record{Type: TypeStruct, Value: []StructItem{
+		{Key: "l_uuid", Value: Record{Type: TypeString, Value: uuid}},
+		{Key: "l_username", Value: Record{Type: TypeString, Value: "trunk"}},
+		{Key: "r_domain", Value: Record{Type: TypeString, Value: "provider.example.com"}},
+		{Key: "realm", Value: Record{Type: TypeString, Value: "provider"}},
+		{Key: "auth_username", Value: Record{Type: TypeString, Value: "user"}},
+		{Key: "auth_password", Value: Record{Type: TypeString, Value: "secret"}},
+		{Key: "expires", Value: Record{Type: TypeInt, Value: 3600}},
+		{Key: "flags", Value: Record{Type: TypeInt, Value: flags}},
+		{Key: "reg_init", Value: Record{Type: TypeInt, Value: 1700000000}},
+	}}
+}
+
+func TestUACRegDump(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		return PacketReply, []Record{
+			uacRegistrationRecord("a", UACRegOnline|UACRegInit),
+			uacRegistrationRecord("b", UACRegDisabled),
+		}
+	})
+
+	registrations, err := UACRegDump(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registrations) != 2 {
+		t.Fatalf("expected 2 registrations, got %d", len(registrations))
+	}
+
+	reg := registrations[0]
+
+	if reg.LUUID != "a" || reg.Realm != "provider" || reg.AuthUsername != "user" || reg.Expires != 3600 || reg.RegInit != 1700000000 {
+		t.Errorf("unexpected registration %+v", reg)
+	}
+
+	if flags := reg.DecodeFlags(); !flags.Online || !flags.Init || flags.Disabled {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+	if flags := registrations[1].DecodeFlags(); !flags.Disabled || flags.Online {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+}
+
+func TestUACRegInfo(t *testing.T) {
+	conn := serve(t, func(request []Record) (uint8, []Record) {
+		if len(request) != 3 {
+			return fault(400, "missing parameters")
+		}
+
+		uuid, _ := request[2].String()
+
+		return PacketReply, []Record{uacRegistrationRecord(uuid, UACRegOngoing)}
+	})
+
+	reg, err := UACRegInfo(conn, "l_uuid", "trunk1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.LUUID != "trunk1" {
+		t.Errorf(`expected "trunk1", got "%s"`, reg.LUUID)
+	}
+	if !reg.DecodeFlags().Ongoing {
+		t.Error("expected registration ongoing")
+	}
+}